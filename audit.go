@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	auditOK      = "ok"
+	auditWarning = "warning"
+	auditError   = "error"
+
+	// exitAuditWarnings is returned when no kubeconfig is broken but some need attention soon
+	exitAuditWarnings = 5
+
+	defaultAuditConcurrency = 8
+)
+
+var auditFormats = []string{formatTable, formatJSON}
+
+// auditResult is the health of a stored kubeconfig. It holds no secret material.
+type auditResult struct {
+	Name    string     `json:"name"`
+	Status  string     `json:"status"`
+	Server  string     `json:"server,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Version string     `json:"version,omitempty"`
+	Issues  []string   `json:"issues,omitempty"`
+}
+
+func (r *auditResult) addIssue(status string, format string, args ...any) {
+	r.Issues = append(r.Issues, fmt.Sprintf(format, args...))
+	if status == auditError || r.Status == auditOK {
+		r.Status = status
+	}
+}
+
+// auditKubeconfig validates a stored kubeconfig, checks the expiry of its credentials and,
+// when probing, whether its API server answers
+func auditKubeconfig(secret infisical.Secret, config appConfig) auditResult {
+	result := auditResult{Name: secretName(secret, config.secretPath), Status: auditOK}
+
+	kubeCfg, err := clientcmd.Load([]byte(secret.SecretValue))
+	if err == nil {
+		err = validateKubeconfig(kubeCfg)
+	}
+	if err != nil {
+		result.addIssue(auditError, "invalid kubeconfig: %v", err)
+		return result
+	}
+
+	summary, err := summarizeKubeconfig(secret.SecretValue)
+	if err != nil {
+		result.addIssue(auditError, "invalid kubeconfig: %v", err)
+		return result
+	}
+	if current, ok := summary.current(); ok {
+		result.Server = current.Server
+	}
+
+	for _, e := range credentialExpiries(summary) {
+		if result.Expires == nil || e.expiry.Before(*result.Expires) {
+			expiry := e.expiry
+			result.Expires = &expiry
+		}
+
+		left := time.Until(e.expiry)
+		switch {
+		case left <= 0:
+			result.addIssue(auditError, "%s of context %s expired on %s", e.what, e.context, e.expiry.Local().Format(time.DateTime))
+		case left < config.expiryWarning:
+			result.addIssue(auditWarning, "%s of context %s expires in %d days", e.what, e.context, int(left.Hours()/24))
+		}
+	}
+
+	if config.probe {
+		check := checkAndCache(secret, config)
+		result.Version = check.Version
+		if check.Error != "" {
+			result.addIssue(auditError, "%s", check.Error)
+		}
+	}
+
+	return result
+}
+
+// auditKubeconfigs audits secrets with a bounded number of workers, keeping their order
+func auditKubeconfigs(secrets []infisical.Secret, config appConfig) []auditResult {
+	results := make([]auditResult, len(secrets))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range max(1, min(config.concurrency, len(secrets))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = auditKubeconfig(secrets[i], config)
+			}
+		}()
+	}
+
+	for i := range secrets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func printAuditTable(results []auditResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tSERVER\tEXPIRES\tISSUES")
+	for _, result := range results {
+		expires := "-"
+		if result.Expires != nil {
+			expires = result.Expires.Local().Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			result.Name,
+			result.Status,
+			result.Server,
+			expires,
+			strings.Join(result.Issues, "; "))
+	}
+	w.Flush()
+}
+
+func handleAudit(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
+	secrets, _ := fetchKubeconfigs(client, projectID, filter, config)
+	results := auditKubeconfigs(secrets, config)
+
+	if config.format == formatJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		printAuditTable(results)
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	fmt.Fprintf(os.Stderr, "%d kubeconfigs audited: %d ok, %d warnings, %d errors\n",
+		len(results), counts[auditOK], counts[auditWarning], counts[auditError])
+
+	switch {
+	case counts[auditError] > 0:
+		exit(1)
+	case counts[auditWarning] > 0:
+		exit(exitAuditWarnings)
+	}
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"text/tabwriter"
 
 	infisical "github.com/infisical/go-sdk"
 	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
 )
 
 type credentialSource int
@@ -17,30 +21,128 @@ const (
 	credentialSourceKeyring credentialSource = iota
 	credentialSourceEnv
 	credentialSourcePrompt
+	credentialSourceLegacy
 )
 
-// clearStoredCredentials removes credentials from keyring
-func clearStoredCredentials() {
-	_ = keyring.Delete(keyringService, clientIDKey)
-	_ = keyring.Delete(keyringService, clientSecretKey)
+// credentialScope identifies the credentials of one Infisical server and profile in the keyring
+type credentialScope struct {
+	Server  string `json:"server"`
+	Profile string `json:"profile"`
+}
+
+// scopeFor returns the keyring scope of the resolved server and profile
+func scopeFor(config appConfig) credentialScope {
+	return credentialScope{
+		Server:  config.infisicalServer,
+		Profile: firstNonEmpty(config.profile, defaultProfileName),
+	}
+}
+
+// account returns the keyring account name of key within the scope
+func (s credentialScope) account(key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.Server, s.Profile, key)
+}
+
+// loadCredentialIndex returns the scopes that have credentials stored in the keyring.
+// The keyring cannot be enumerated, so ikube keeps its own index next to the credentials.
+func loadCredentialIndex() ([]credentialScope, error) {
+	data, err := keyring.Get(keyringService, credentialIndexKey)
+	if err == keyring.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential index from keyring: %v", err)
+	}
+
+	var scopes []credentialScope
+	if err := json.Unmarshal([]byte(data), &scopes); err != nil {
+		return nil, fmt.Errorf("failed to parse credential index: %v", err)
+	}
+	return scopes, nil
+}
+
+func saveCredentialIndex(scopes []credentialScope) error {
+	if len(scopes) == 0 {
+		err := keyring.Delete(keyringService, credentialIndexKey)
+		if err != nil && err != keyring.ErrNotFound {
+			return fmt.Errorf("failed to delete credential index from keyring: %v", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(scopes)
+	if err != nil {
+		return fmt.Errorf("failed to serialize credential index: %v", err)
+	}
+	if err := keyring.Set(keyringService, credentialIndexKey, string(data)); err != nil {
+		return fmt.Errorf("failed to store credential index in keyring: %v", err)
+	}
+	return nil
 }
 
-// storeCredentials saves valid credentials to keyring
-func storeCredentials(clientID, clientSecret string) error {
-	if err := keyring.Set(keyringService, clientIDKey, clientID); err != nil {
+// clearStoredCredentials removes the credentials of scope from keyring
+func clearStoredCredentials(scope credentialScope) error {
+	_ = keyring.Delete(keyringService, scope.account(clientIDKey))
+	_ = keyring.Delete(keyringService, scope.account(clientSecretKey))
+
+	scopes, err := loadCredentialIndex()
+	if err != nil {
+		return err
+	}
+	scopes = slices.DeleteFunc(scopes, func(s credentialScope) bool {
+		return s == scope
+	})
+	return saveCredentialIndex(scopes)
+}
+
+// storeCredentials saves valid credentials of scope to keyring
+func storeCredentials(scope credentialScope, clientID, clientSecret string) error {
+	if err := keyring.Set(keyringService, scope.account(clientIDKey), clientID); err != nil {
 		return fmt.Errorf("failed to store client ID in keyring: %v", err)
 	}
 
-	if err := keyring.Set(keyringService, clientSecretKey, clientSecret); err != nil {
+	if err := keyring.Set(keyringService, scope.account(clientSecretKey), clientSecret); err != nil {
 		// If we failed to store the secret, remove the ID as well
-		_ = keyring.Delete(keyringService, clientIDKey)
+		_ = keyring.Delete(keyringService, scope.account(clientIDKey))
 		return fmt.Errorf("failed to store client secret in keyring: %v", err)
 	}
 
+	scopes, err := loadCredentialIndex()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(scopes, scope) {
+		scopes = append(scopes, scope)
+	}
+	return saveCredentialIndex(scopes)
+}
+
+// legacyCredentials returns the credentials stored by previous versions, which were not namespaced,
+// or empty strings when there are none
+func legacyCredentials() (string, string) {
+	clientID, err := keyring.Get(keyringService, clientIDKey)
+	if err != nil {
+		return "", ""
+	}
+	clientSecret, err := keyring.Get(keyringService, clientSecretKey)
+	if err != nil {
+		return "", ""
+	}
+	return clientID, clientSecret
+}
+
+// migrateLegacyCredentials moves the legacy credentials, once they proved valid, to scope.
+// They are only deleted when they could be stored under the scope.
+func migrateLegacyCredentials(scope credentialScope, clientID, clientSecret string) error {
+	if err := storeCredentials(scope, clientID, clientSecret); err != nil {
+		return err
+	}
+	_ = keyring.Delete(keyringService, clientIDKey)
+	_ = keyring.Delete(keyringService, clientSecretKey)
 	return nil
 }
 
-func getCredentials(forcePrompt bool) (string, string, credentialSource, error) {
+func getCredentials(scope credentialScope, forcePrompt bool) (string, string, credentialSource, error) {
 	if !forcePrompt {
 		// First try environment variables
 		clientID := os.Getenv("INFISICAL_CLIENT_ID")
@@ -54,19 +156,26 @@ func getCredentials(forcePrompt bool) (string, string, credentialSource, error)
 		// Try to get from keyring
 		var err error
 		if clientID == "" {
-			clientID, err = keyring.Get(keyringService, clientIDKey)
+			clientID, err = keyring.Get(keyringService, scope.account(clientIDKey))
 			if err != nil && err != keyring.ErrNotFound {
 				return "", "", credentialSourcePrompt, fmt.Errorf("failed to get client ID from keyring: %v", err)
 			}
 		}
 
 		if clientSecret == "" {
-			clientSecret, err = keyring.Get(keyringService, clientSecretKey)
+			clientSecret, err = keyring.Get(keyringService, scope.account(clientSecretKey))
 			if err != nil && err != keyring.ErrNotFound {
 				return "", "", credentialSourcePrompt, fmt.Errorf("failed to get client secret from keyring: %v", err)
 			}
 		}
 
+		// Fall back to credentials stored before keyring entries were namespaced, which belong to the default profile
+		if clientID == "" && clientSecret == "" && scope.Profile == defaultProfileName {
+			if clientID, clientSecret = legacyCredentials(); clientID != "" {
+				return clientID, clientSecret, credentialSourceLegacy, nil
+			}
+		}
+
 		// If we found both in keyring, return them
 		if clientID != "" && clientSecret != "" {
 			return clientID, clientSecret, credentialSourceKeyring, nil
@@ -77,96 +186,226 @@ func getCredentials(forcePrompt bool) (string, string, credentialSource, error)
 	return promptForCredentials()
 }
 
+// promptForCredentials asks for credentials on the controlling terminal rather than stdin,
+// which may carry a kubeconfig, and does not echo the client secret
 func promptForCredentials() (string, string, credentialSource, error) {
-	reader := bufio.NewReader(os.Stdin)
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", "", credentialSourcePrompt, fmt.Errorf("no terminal available to prompt for credentials, set INFISICAL_CLIENT_ID and INFISICAL_CLIENT_SECRET or use another auth method")
+	}
+	defer tty.Close()
+
+	reader := bufio.NewReader(tty)
 
-	fmt.Print("Enter Infisical Client ID: ")
+	fmt.Fprint(tty, "Enter Infisical Client ID: ")
 	clientID, err := reader.ReadString('\n')
 	if err != nil {
 		return "", "", credentialSourcePrompt, fmt.Errorf("failed to read client ID: %v", err)
 	}
 	clientID = strings.TrimSpace(clientID)
 
-	fmt.Print("Enter Infisical Client Secret: ")
-	clientSecret, err := reader.ReadString('\n')
+	// ReadPassword restores echo when it returns, but not when a signal makes ikube exit meanwhile
+	if state, err := term.GetState(int(tty.Fd())); err == nil {
+		unregister := registerExitHook(func() {
+			fmt.Fprintln(tty)
+			term.Restore(int(tty.Fd()), state)
+		})
+		defer unregister()
+	}
+
+	fmt.Fprint(tty, "Enter Infisical Client Secret: ")
+	secret, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
 	if err != nil {
 		return "", "", credentialSourcePrompt, fmt.Errorf("failed to read client secret: %v", err)
 	}
-	clientSecret = strings.TrimSpace(clientSecret)
+	clientSecret := strings.TrimSpace(string(secret))
+
+	if clientID == "" || clientSecret == "" {
+		return "", "", credentialSourcePrompt, fmt.Errorf("client ID and client secret must not be empty")
+	}
 
 	return clientID, clientSecret, credentialSourcePrompt, nil
 }
 
+func newInfisicalClient(ctx context.Context, config appConfig) infisical.InfisicalClientInterface {
+	autoRefresh := true
+	return infisical.NewInfisicalClient(ctx, infisical.Config{
+		SiteUrl:          fmt.Sprintf("https://%s", config.infisicalServer),
+		AutoTokenRefresh: &autoRefresh,
+	})
+}
+
 func authenticateInfisical(ctx context.Context, config appConfig) (infisical.InfisicalClientInterface, error) {
+	// Machine identity methods are non-interactive and never touch the keyring
+	if config.authMethod != authMethodUniversal {
+		client := newInfisicalClient(ctx, config)
+		if err := loginWithAuthMethod(client, config); err != nil {
+			if config.verbose {
+				return nil, err
+			}
+			return nil, fmt.Errorf("authentication failed")
+		}
+		return client, nil
+	}
+
+	scope := scopeFor(config)
+
 	// First attempt with stored or env credentials
-	clientID, clientSecret, source, err := getCredentials(false)
+	clientID, clientSecret, source, err := getCredentials(scope, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get credentials: %v", err)
 	}
 
-	autoRefresh := true
-	client := infisical.NewInfisicalClient(ctx, infisical.Config{
-		SiteUrl:          fmt.Sprintf("https://%s", config.infisicalServer),
-		AutoTokenRefresh: &autoRefresh,
-	})
+	client := newInfisicalClient(ctx, config)
 
 	_, err = client.Auth().UniversalAuthLogin(clientID, clientSecret)
 	if err == nil {
 		// Only persist credentials that were manually entered; env vars are intentionally transient
 		if source == credentialSourcePrompt {
-			if err := storeCredentials(clientID, clientSecret); err != nil {
+			if err := storeCredentials(scope, clientID, clientSecret); err != nil {
 				if config.verbose {
-					fmt.Printf("Warning: Failed to store credentials: %v\n", err)
+					fmt.Fprintf(os.Stderr, "Warning: Failed to store credentials: %v\n", err)
 				} else {
-					fmt.Println("Warning: Failed to store credentials")
+					fmt.Fprintln(os.Stderr, "Warning: Failed to store credentials")
 				}
 			}
 		}
+		if source == credentialSourceLegacy {
+			if err := migrateLegacyCredentials(scope, clientID, clientSecret); err != nil && config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to migrate stored credentials: %v\n", err)
+			}
+		}
 		return client, nil
 	}
 
+	// Legacy credentials are left in place: they may be valid for another server
+	if source == credentialSourceLegacy {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Stored credentials are invalid for %s: %v\n", scope.Server, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Stored credentials are invalid for %s\n", scope.Server)
+		}
+		return loginInfisical(ctx, config)
+	}
+
 	// If credentials were from keyring and invalid, clear them and try once more
 	if source == credentialSourceKeyring {
 		if config.verbose {
-			fmt.Printf("Stored credentials are invalid: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Stored credentials are invalid: %v\n", err)
 		} else {
-			fmt.Println("Stored credentials are invalid")
+			fmt.Fprintln(os.Stderr, "Stored credentials are invalid")
 		}
-		clearStoredCredentials()
+		_ = clearStoredCredentials(scope)
 
-		// Second attempt with manual input
-		clientID, clientSecret, _, err = getCredentials(true)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get credentials: %v", err)
+		return loginInfisical(ctx, config)
+	}
+
+	// If credentials were from env vars or manual input and failed, exit
+	if config.verbose {
+		return nil, fmt.Errorf("authentication failed: %v", err)
+	}
+	return nil, fmt.Errorf("authentication failed")
+}
+
+// loginInfisical prompts for credentials, authenticates with them and stores them in the keyring
+func loginInfisical(ctx context.Context, config appConfig) (infisical.InfisicalClientInterface, error) {
+	scope := scopeFor(config)
+
+	clientID, clientSecret, _, err := getCredentials(scope, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %v", err)
+	}
+
+	client := newInfisicalClient(ctx, config)
+
+	_, err = client.Auth().UniversalAuthLogin(clientID, clientSecret)
+	if err != nil {
+		if config.verbose {
+			return nil, fmt.Errorf("authentication failed with new credentials: %v", err)
 		}
+		return nil, fmt.Errorf("authentication failed with new credentials")
+	}
 
-		client = infisical.NewInfisicalClient(ctx, infisical.Config{
-			SiteUrl:          fmt.Sprintf("https://%s", config.infisicalServer),
-			AutoTokenRefresh: &autoRefresh,
-		})
+	// Store the valid credentials entered by the user
+	if err := storeCredentials(scope, clientID, clientSecret); err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to store credentials: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning: Failed to store credentials")
+		}
+	}
+	return client, nil
+}
 
-		_, err = client.Auth().UniversalAuthLogin(clientID, clientSecret)
-		if err == nil {
-			// Store the valid credentials entered by the user
-			if err := storeCredentials(clientID, clientSecret); err != nil {
-				if config.verbose {
-					fmt.Printf("Warning: Failed to store credentials: %v\n", err)
-				} else {
-					fmt.Println("Warning: Failed to store credentials")
-				}
+func handleAuthLogin(ctx context.Context, config appConfig) {
+	if _, err := loginInfisical(ctx, config); err != nil {
+		if config.verbose {
+			fmt.Printf("Failed to log in: %v\n", err)
+		} else {
+			fmt.Printf("Failed to log in on %s\n", config.infisicalServer)
+		}
+		exit(1)
+	}
+
+	scope := scopeFor(config)
+	fmt.Printf("Successfully logged in on %s (profile: %s)\n", scope.Server, scope.Profile)
+}
+
+func handleAuthLogout(config appConfig, all bool) {
+	scopes := []credentialScope{scopeFor(config)}
+	if all {
+		var err error
+		scopes, err = loadCredentialIndex()
+		if err != nil {
+			if config.verbose {
+				fmt.Printf("Failed to list stored credentials: %v\n", err)
+			} else {
+				fmt.Println("Failed to list stored credentials")
 			}
-			return client, nil
+			exit(1)
 		}
+	}
 
+	for _, scope := range scopes {
+		if err := clearStoredCredentials(scope); err != nil {
+			if config.verbose {
+				fmt.Printf("Failed to remove credentials for %s (profile: %s): %v\n", scope.Server, scope.Profile, err)
+			} else {
+				fmt.Printf("Failed to remove credentials for %s (profile: %s)\n", scope.Server, scope.Profile)
+			}
+			exit(1)
+		}
+		fmt.Printf("Successfully logged out from %s (profile: %s)\n", scope.Server, scope.Profile)
+	}
+}
+
+func handleAuthList(config appConfig) {
+	scopes, err := loadCredentialIndex()
+	if err != nil {
 		if config.verbose {
-			return nil, fmt.Errorf("authentication failed with new credentials: %v", err)
+			fmt.Printf("Failed to list stored credentials: %v\n", err)
+		} else {
+			fmt.Println("Failed to list stored credentials")
 		}
-		return nil, fmt.Errorf("authentication failed with new credentials")
+		exit(1)
 	}
 
-	// If credentials were from env vars or manual input and failed, exit
-	if config.verbose {
-		return nil, fmt.Errorf("authentication failed: %v", err)
+	if len(scopes) == 0 {
+		fmt.Println("No stored credentials")
+		return
 	}
-	return nil, fmt.Errorf("authentication failed")
+
+	current := scopeFor(config)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSERVER\tPROFILE\tCLIENT ID")
+	for _, scope := range scopes {
+		marker := ""
+		if scope == current {
+			marker = "*"
+		}
+		clientID, _ := keyring.Get(keyringService, scope.account(clientIDKey))
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", marker, scope.Server, scope.Profile, clientID)
+	}
+	w.Flush()
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	infisical "github.com/infisical/go-sdk"
+)
+
+const (
+	authMethodUniversal  = "universal"
+	authMethodToken      = "token"
+	authMethodKubernetes = "kubernetes"
+	authMethodAwsIam     = "aws-iam"
+	authMethodGcpIDToken = "gcp-id-token"
+	authMethodGcpIam     = "gcp-iam"
+	authMethodAzure      = "azure"
+	authMethodOidc       = "oidc"
+)
+
+var authMethods = []string{
+	authMethodUniversal,
+	authMethodToken,
+	authMethodKubernetes,
+	authMethodAwsIam,
+	authMethodGcpIDToken,
+	authMethodGcpIam,
+	authMethodAzure,
+	authMethodOidc,
+}
+
+// resolveAuthMethod picks the authentication method from the flag, INFISICAL_AUTH_METHOD or the profile,
+// falling back to a raw access token when INFISICAL_TOKEN is set and to universal auth otherwise
+func resolveAuthMethod(config *appConfig, profileMethod string) error {
+	defaultMethod := authMethodUniversal
+	if os.Getenv("INFISICAL_TOKEN") != "" {
+		defaultMethod = authMethodToken
+	}
+
+	config.authMethod = firstNonEmpty(config.authMethod, os.Getenv("INFISICAL_AUTH_METHOD"), profileMethod, defaultMethod)
+	for _, method := range authMethods {
+		if config.authMethod == method {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid auth method '%s', expected one of %s", config.authMethod, strings.Join(authMethods, ", "))
+}
+
+// loginWithAuthMethod authenticates client with a non-interactive authentication method.
+// Identity IDs left empty are read by the SDK from the method-specific environment variables.
+func loginWithAuthMethod(client infisical.InfisicalClientInterface, config appConfig) error {
+	var err error
+	switch config.authMethod {
+	case authMethodToken:
+		token := os.Getenv("INFISICAL_TOKEN")
+		if token == "" {
+			return fmt.Errorf("INFISICAL_TOKEN environment variable is not set")
+		}
+		client.Auth().SetAccessToken(token)
+	case authMethodKubernetes:
+		_, err = client.Auth().KubernetesAuthLogin(config.identityID, os.Getenv("INFISICAL_KUBERNETES_SERVICE_ACCOUNT_TOKEN_PATH"))
+	case authMethodAwsIam:
+		_, err = client.Auth().AwsIamAuthLogin(config.identityID)
+	case authMethodGcpIDToken:
+		_, err = client.Auth().GcpIdTokenAuthLogin(config.identityID)
+	case authMethodGcpIam:
+		_, err = client.Auth().GcpIamAuthLogin(config.identityID, os.Getenv("INFISICAL_GCP_IAM_SERVICE_ACCOUNT_KEY_FILE_PATH"))
+	case authMethodAzure:
+		_, err = client.Auth().AzureAuthLogin(config.identityID, os.Getenv("INFISICAL_AZURE_AUTH_RESOURCE"))
+	case authMethodOidc:
+		jwt := os.Getenv("INFISICAL_JWT")
+		if jwt == "" {
+			return fmt.Errorf("INFISICAL_JWT environment variable is not set")
+		}
+		_, err = client.Auth().OidcAuthLogin(config.identityID, jwt)
+	default:
+		return fmt.Errorf("unsupported auth method '%s'", config.authMethod)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s authentication failed: %v", config.authMethod, err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+const (
+	backupDirName    = "ikube-backups"
+	backupPrefix     = "config-"
+	backupTimeLayout = "20060102-150405.000"
+	defaultBackups   = 10
+)
+
+type kubeconfigBackup struct {
+	path      string
+	createdAt time.Time
+}
+
+// backupRetention returns how many backups are kept, from the backups setting of the configuration file
+func backupRetention(fc fileConfig) (int, error) {
+	if fc.Backups == nil {
+		return defaultBackups, nil
+	}
+	if *fc.Backups < 1 {
+		return 0, fmt.Errorf("invalid backups %d, at least one backup must be kept", *fc.Backups)
+	}
+	return *fc.Backups, nil
+}
+
+// backupKubeconfig copies the kubeconfig at path into the backup directory and rotates old backups
+// so that at most keep remain. It returns the backup path, or an empty string when there was nothing
+// to back up. When the kubeconfig did not change since the newest backup, that backup is returned.
+func backupKubeconfig(path string, keep int) (string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	dir := filepath.Join(filepath.Dir(path), backupDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	backups, err := listBackups(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(backups) > 0 {
+		newest, err := os.ReadFile(backups[0].path)
+		if err == nil && bytes.Equal(newest, content) {
+			return backups[0].path, nil
+		}
+	}
+
+	backupPath := filepath.Join(dir, backupPrefix+time.Now().Format(backupTimeLayout)+".yaml")
+	if err := writeFileAtomic(backupPath, content, 0600); err != nil {
+		return "", err
+	}
+
+	if err := rotateBackups(dir, keep); err != nil {
+		return backupPath, err
+	}
+
+	return backupPath, nil
+}
+
+// listBackups returns the backups found in dir, newest first
+func listBackups(dir string) ([]kubeconfigBackup, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	var backups []kubeconfigBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), ".yaml")
+		createdAt, err := time.ParseInLocation(backupTimeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, kubeconfigBackup{path: filepath.Join(dir, name), createdAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].createdAt.After(backups[j].createdAt)
+	})
+
+	return backups, nil
+}
+
+// rotateBackups removes the oldest backups so that at most keep remain
+func rotateBackups(dir string, keep int) error {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups[min(len(backups), keep):] {
+		if err := os.Remove(backup.path); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %v", backup.path, err)
+		}
+	}
+
+	return nil
+}
+
+func handleRestore(config appConfig) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error getting home directory: %v\n", err)
+		} else {
+			fmt.Println("Error getting home directory")
+		}
+		exit(1)
+	}
+
+	kubeconfigPath := filepath.Join(homeDir, ".kube", "config")
+	backups, err := listBackups(filepath.Join(homeDir, ".kube", backupDirName))
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Failed to list backups: %v\n", err)
+		} else {
+			fmt.Println("Failed to list backups")
+		}
+		exit(1)
+	}
+
+	if len(backups) == 0 {
+		fmt.Println("No kubeconfig backups found")
+		return
+	}
+
+	current, err := os.ReadFile(kubeconfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		if config.verbose {
+			fmt.Printf("Error reading kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error reading kubeconfig")
+		}
+		exit(1)
+	}
+
+	idx, err := fuzzyfinder.Find(
+		backups,
+		func(i int) string {
+			return backups[i].createdAt.Format(time.DateTime)
+		},
+		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
+			if i == -1 {
+				return ""
+			}
+
+			content, err := os.ReadFile(backups[i].path)
+			if err != nil {
+				return fmt.Sprintf("Error reading backup: %v", err)
+			}
+
+			diff := lineDiff(string(current), string(content))
+			if diff == "" {
+				return "Backup is identical to the current kubeconfig"
+			}
+			return fmt.Sprintf("--- current\n+++ %s\n%s", filepath.Base(backups[i].path), diff)
+		}),
+	)
+
+	if err != nil {
+		if err == fuzzyfinder.ErrAbort {
+			fmt.Println("Selection cancelled")
+			return
+		}
+		if config.verbose {
+			fmt.Printf("Error during selection: %v\n", err)
+		} else {
+			fmt.Println("Error during selection")
+		}
+		exit(1)
+	}
+
+	content, err := os.ReadFile(backups[idx].path)
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error reading backup: %v\n", err)
+		} else {
+			fmt.Println("Error reading backup")
+		}
+		exit(1)
+	}
+
+	// Back up the current kubeconfig first so the restore itself can be undone
+	if _, err := backupKubeconfig(kubeconfigPath, config.backups); err != nil {
+		if config.verbose {
+			fmt.Printf("Error backing up kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error backing up kubeconfig")
+		}
+		exit(1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(kubeconfigPath), 0755); err != nil {
+		if config.verbose {
+			fmt.Printf("Error creating .kube directory: %v\n", err)
+		} else {
+			fmt.Println("Error creating .kube directory")
+		}
+		exit(1)
+	}
+
+	if err := writeFileAtomic(kubeconfigPath, content, 0600); err != nil {
+		if config.verbose {
+			fmt.Printf("Error restoring kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error restoring kubeconfig")
+		}
+		exit(1)
+	}
+
+	fmt.Printf("Successfully restored kubeconfig from backup: %s\n", backups[idx].createdAt.Format(time.DateTime))
+}
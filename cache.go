@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	cacheKeyName      = "cache_key"
+	defaultCacheTTL   = 7 * 24 * time.Hour
+	cacheFileSuffix   = ".cache"
+	cacheKeySizeBytes = 32
+)
+
+// secretCache is the decrypted content of a cache file
+type secretCache struct {
+	FetchedAt time.Time          `json:"fetchedAt"`
+	Secrets   []infisical.Secret `json:"secrets"`
+}
+
+// cacheDir returns the directory holding the encrypted kubeconfig caches
+func cacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "ikube"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".cache", "ikube"), nil
+}
+
+// cacheIdentity identifies the Infisical location a cache was fetched from
+func cacheIdentity(config appConfig) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%t", config.infisicalServer, config.projectID, config.environment, config.secretPath, config.recursive)
+}
+
+func cacheFilePath(config appConfig) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(cacheIdentity(config)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+cacheFileSuffix), nil
+}
+
+// cacheKey returns the cache encryption key held in the keyring, generating it on first use when create is set
+func cacheKey(create bool) ([]byte, error) {
+	encoded, err := keyring.Get(keyringService, cacheKeyName)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != cacheKeySizeBytes {
+			return nil, fmt.Errorf("invalid cache key in keyring")
+		}
+		return key, nil
+	}
+	if err != keyring.ErrNotFound {
+		return nil, fmt.Errorf("failed to get cache key from keyring: %v", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("no cache key in keyring")
+	}
+
+	key := make([]byte, cacheKeySizeBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cache key: %v", err)
+	}
+	if err := keyring.Set(keyringService, cacheKeyName, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to store cache key in keyring: %v", err)
+	}
+	return key, nil
+}
+
+func newCacheCipher(create bool) (cipher.AEAD, error) {
+	key, err := cacheKey(create)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// saveSecretCache encrypts secrets and writes them to the cache of the current Infisical location
+func saveSecretCache(config appConfig, secrets []infisical.Secret) error {
+	aead, err := newCacheCipher(true)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(secretCache{FetchedAt: time.Now(), Secrets: secrets})
+	if err != nil {
+		return fmt.Errorf("failed to serialize cache: %v", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	// The identity is authenticated so a cache file cannot be swapped for another location's
+	ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(cacheIdentity(config)))
+
+	path, err := cacheFilePath(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return writeFileAtomic(path, ciphertext, 0600)
+}
+
+// loadSecretCache decrypts the cache of the current Infisical location, rejecting it when older than the TTL
+func loadSecretCache(config appConfig) (secretCache, error) {
+	var cache secretCache
+
+	path, err := cacheFilePath(config)
+	if err != nil {
+		return cache, err
+	}
+	ciphertext, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, fmt.Errorf("no cached kubeconfigs for this Infisical location")
+	}
+	if err != nil {
+		return cache, fmt.Errorf("failed to read cache: %v", err)
+	}
+
+	aead, err := newCacheCipher(false)
+	if err != nil {
+		return cache, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return cache, fmt.Errorf("cache file is corrupted")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(cacheIdentity(config)))
+	if err != nil {
+		return cache, fmt.Errorf("failed to decrypt cache: %v", err)
+	}
+
+	if err := json.Unmarshal(plaintext, &cache); err != nil {
+		return cache, fmt.Errorf("failed to parse cache: %v", err)
+	}
+
+	if config.cacheTTL > 0 && time.Since(cache.FetchedAt) > config.cacheTTL {
+		return cache, fmt.Errorf("cached kubeconfigs expired, fetched %s", cache.FetchedAt.Format(time.DateTime))
+	}
+
+	return cache, nil
+}
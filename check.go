@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultCheckTimeout = 5 * time.Second
+	checkCacheFile      = "checks.json"
+)
+
+// checkCacheMu serializes the updates of the check cache, which audit makes concurrently
+var checkCacheMu sync.Mutex
+
+// checkResult is the outcome of contacting the API server of a kubeconfig. It holds no secret material
+// and is cached so that the picker preview can show the last known state of each cluster.
+type checkResult struct {
+	Name      string    `json:"name"`
+	Server    string    `json:"server,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// describeRequestError turns a request failure into a short message, calling out TLS and timeout errors
+func describeRequestError(err error, timeout time.Duration) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verification *tls.CertificateVerificationError
+	var urlErr *url.Error
+
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostname), errors.As(err, &invalid), errors.As(err, &verification):
+		return fmt.Sprintf("TLS error: %v", errors.Unwrap(err))
+	case errors.As(err, &urlErr) && urlErr.Timeout():
+		return fmt.Sprintf("no answer within %s", timeout)
+	default:
+		return err.Error()
+	}
+}
+
+// selfSubjectReview asks the API server who the credentials authenticate as. SelfSubjectReview is GA since
+// Kubernetes 1.28, older clusters are asked through the beta API.
+func selfSubjectReview(httpClient *http.Client, host string) (string, []string, error) {
+	var lastStatus string
+	for _, version := range []string{"v1", "v1beta1"} {
+		body := fmt.Sprintf(`{"apiVersion":"authentication.k8s.io/%s","kind":"SelfSubjectReview"}`, version)
+		resp, err := httpClient.Post(host+"/apis/authentication.k8s.io/"+version+"/selfsubjectreviews", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusCreated:
+			var review struct {
+				Status struct {
+					UserInfo struct {
+						Username string   `json:"username"`
+						Groups   []string `json:"groups"`
+					} `json:"userInfo"`
+				} `json:"status"`
+			}
+			if err := json.Unmarshal(data, &review); err != nil {
+				return "", nil, fmt.Errorf("failed to decode SelfSubjectReview: %v", err)
+			}
+			return review.Status.UserInfo.Username, review.Status.UserInfo.Groups, nil
+		case http.StatusUnauthorized:
+			return "", nil, fmt.Errorf("credentials rejected (401 Unauthorized)")
+		case http.StatusNotFound:
+			lastStatus = resp.Status
+			continue
+		default:
+			return "", nil, fmt.Errorf("SelfSubjectReview failed: %s", resp.Status)
+		}
+	}
+	return "", nil, fmt.Errorf("SelfSubjectReview not supported by the API server (%s)", lastStatus)
+}
+
+// checkKubeconfig contacts the API server of the current context of a kubeconfig, fetching its version
+// and the identity the credentials authenticate as
+func checkKubeconfig(name string, value string, timeout time.Duration) checkResult {
+	result := checkResult{Name: name, CheckedAt: time.Now()}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(value))
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid kubeconfig: %v", err)
+		return result
+	}
+	restConfig.Timeout = timeout
+	result.Server = restConfig.Host
+
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid client configuration: %v", err)
+		return result
+	}
+	host := strings.TrimSuffix(restConfig.Host, "/")
+
+	resp, err := httpClient.Get(host + "/version")
+	if err != nil {
+		result.Error = describeRequestError(err, timeout)
+		return result
+	}
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&version)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("GET /version failed: %s", resp.Status)
+		return result
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to decode version: %v", err)
+		return result
+	}
+	result.Version = version.GitVersion
+
+	result.Username, result.Groups, err = selfSubjectReview(httpClient, host)
+	if err != nil {
+		result.Error = describeRequestError(err, timeout)
+	}
+
+	return result
+}
+
+// checkCacheKey identifies a stored kubeconfig across Infisical locations
+func checkCacheKey(secret infisical.Secret, config appConfig) string {
+	return fmt.Sprintf("%s|%s|%s|%s", config.infisicalServer, config.projectID, config.environment, secretTimestampKey(secret.SecretPath, secret.SecretKey))
+}
+
+// loadCheckResults returns the cached check results, keyed by checkCacheKey
+func loadCheckResults() map[string]checkResult {
+	results := make(map[string]checkResult)
+
+	dir, err := cacheDir()
+	if err != nil {
+		return results
+	}
+	data, err := os.ReadFile(filepath.Join(dir, checkCacheFile))
+	if err != nil {
+		return results
+	}
+	_ = json.Unmarshal(data, &results)
+	return results
+}
+
+// saveCheckResult records the result of checking secret, for the picker preview
+func saveCheckResult(secret infisical.Secret, result checkResult, config appConfig) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+
+	checkCacheMu.Lock()
+	defer checkCacheMu.Unlock()
+
+	results := loadCheckResults()
+	results[checkCacheKey(secret, config)] = result
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize check results: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return writeFileAtomic(filepath.Join(dir, checkCacheFile), data, 0600)
+}
+
+// checkAndCache checks secret and caches the result
+func checkAndCache(secret infisical.Secret, config appConfig) checkResult {
+	timeout := config.checkTimeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	result := checkKubeconfig(secretName(secret, config.secretPath), secret.SecretValue, timeout)
+	if err := saveCheckResult(secret, result, config); err != nil && config.verbose {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to cache check result: %v\n", err)
+	}
+	return result
+}
+
+// summary describes a check result in one line
+func (r checkResult) summary() string {
+	if r.Error != "" {
+		return fmt.Sprintf("FAILED: %s", r.Error)
+	}
+	identity := r.Username
+	if len(r.Groups) > 0 {
+		identity = fmt.Sprintf("%s (%s)", r.Username, strings.Join(r.Groups, ", "))
+	}
+	return fmt.Sprintf("OK, Kubernetes %s, authenticated as %s", r.Version, identity)
+}
+
+// verifyKubeconfig checks secret before it is used and reports whether it works, explaining why on stderr
+func verifyKubeconfig(secret infisical.Secret, config appConfig) bool {
+	result := checkAndCache(secret, config)
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: Cluster %s failed verification: %s\n", result.Name, result.Error)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Verified cluster %s: %s\n", result.Name, result.summary())
+	return true
+}
+
+func handleCheckKubeconfig(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
+	secret, ok := selectKubeconfig(client, projectID, filter, config)
+	if !ok {
+		return
+	}
+
+	result := checkAndCache(secret, config)
+	fmt.Printf("Cluster: %s\n", result.Name)
+	fmt.Printf("Server: %s\n", result.Server)
+	if result.Version != "" {
+		fmt.Printf("Version: %s\n", result.Version)
+	}
+	if result.Username != "" {
+		fmt.Printf("User: %s\n", result.Username)
+		fmt.Printf("Groups: %s\n", strings.Join(result.Groups, ", "))
+	}
+	if result.Error != "" {
+		fmt.Printf("Error: %s\n", result.Error)
+		exit(1)
+	}
+}
@@ -1,14 +1,305 @@
 package main
 
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
 type appConfig struct {
 	verbose         bool
+	profile         string
+	explicit        map[string]bool
 	temp            bool
-	delete          bool
+	overwrite       bool
+	file            string
+	split           bool
+	contexts        string
+	allContexts     bool
+	noMinify        bool
+	allowUnresolved bool
 	infisicalServer string
+	projectID       string
+	environment     string
+	secretPath      string
+	authMethod      string
+	identityID      string
+	folder          string
+	recursive       bool
+	exact           string
+	outputPath      string
+	stdout          bool
+	multi           bool
+	shell           string
+	sessionPID      int
+	format          string
+	verify          bool
+	checkTimeout    time.Duration
+	probe           bool
+	concurrency     int
+	expiryWarning   time.Duration
+	force           bool
+	lint            bool
+	lintPolicy      lintPolicy
+	install         bool
+	credentialUser  string
+	credentialTTL   time.Duration
+	cacheable       bool
+	cache           bool
+	offline         bool
+	cacheTTL        time.Duration
+	backups         int
+	// profileOutput applies the output setting of the configuration file, which only "ikube use" follows
+	profileOutput bool
 }
 
 const (
 	keyringService  = "kube-infisical"
 	clientIDKey     = "client_id"
 	clientSecretKey = "client_secret"
+
+	// credentialIndexKey lists the server and profile pairs that have credentials in the keyring
+	credentialIndexKey = "credentials"
+	defaultProfileName = "default"
+)
+
+const (
+	defaultInfisicalServer = "app.infisical.com"
+	defaultEnvironment     = "config"
+	defaultSecretPath      = "/"
+)
+
+const (
+	outputKubeconfig = "kubeconfig"
+	outputShell      = "shell"
+	outputStdout     = "stdout"
+
+	writeMerge     = "merge"
+	writeOverwrite = "overwrite"
 )
+
+// profileConfig holds the settings of a named profile of the configuration file
+type profileConfig struct {
+	Server      string `json:"server,omitempty"`
+	ProjectID   string `json:"projectID,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Output      string `json:"output,omitempty"`
+	Write       string `json:"write,omitempty"`
+	AuthMethod  string `json:"authMethod,omitempty"`
+	IdentityID  string `json:"identityID,omitempty"`
+	Cache       *bool  `json:"cache,omitempty"`
+	CacheTTL    string `json:"cacheTTL,omitempty"`
+	// ExpiryWarning is how long before their expiry credentials are warned about, e.g. "168h"
+	ExpiryWarning string `json:"expiryWarning,omitempty"`
+	// Lint is the validation policy applied to kubeconfigs
+	Lint *lintConfig `json:"lint,omitempty"`
+}
+
+// fileConfig is the content of the ikube configuration file.
+// Top-level settings apply to every profile unless the profile overrides them.
+type fileConfig struct {
+	profileConfig
+	DefaultProfile string                   `json:"defaultProfile,omitempty"`
+	Profiles       map[string]profileConfig `json:"profiles,omitempty"`
+	// Backups is how many backups of ~/.kube/config are kept
+	Backups *int `json:"backups,omitempty"`
+}
+
+// configFilePath returns the location of the ikube configuration file
+func configFilePath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "ikube", "config.yaml"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "ikube", "config.yaml"), nil
+}
+
+// loadFileConfig reads the ikube configuration file, returning an empty config when it does not exist
+func loadFileConfig() (fileConfig, error) {
+	var fc fileConfig
+
+	configPath, err := configFilePath()
+	if err != nil {
+		return fc, err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return fc, nil
+	}
+	if err != nil {
+		return fc, fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &fc); err != nil {
+		return fc, fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+
+	return fc, nil
+}
+
+// firstNonEmpty returns the first value that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// selectedProfile returns the settings of the profile chosen with --profile, IKUBE_PROFILE or defaultProfile
+func selectedProfile(config *appConfig, fc fileConfig) (profileConfig, error) {
+	config.profile = firstNonEmpty(config.profile, os.Getenv("IKUBE_PROFILE"), fc.DefaultProfile)
+	if config.profile == "" {
+		return profileConfig{}, nil
+	}
+
+	profile, exists := fc.Profiles[config.profile]
+	if !exists {
+		return profileConfig{}, fmt.Errorf("profile '%s' not found in configuration file", config.profile)
+	}
+	return profile, nil
+}
+
+// resolveSettings fills the Infisical settings of config that were not given as flags,
+// from environment variables, then the selected profile, then the top-level configuration, then the defaults.
+// A profile selected with --profile or IKUBE_PROFILE takes precedence over the environment variables.
+func resolveSettings(config *appConfig) error {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+
+	// A profile chosen explicitly, rather than through defaultProfile, is not masked by environment variables
+	explicitProfile := firstNonEmpty(config.profile, os.Getenv("IKUBE_PROFILE")) != ""
+	profile, err := selectedProfile(config, fc)
+	if err != nil {
+		return err
+	}
+	envOrProfile := func(name, fromProfile string) string {
+		if explicitProfile {
+			return firstNonEmpty(fromProfile, os.Getenv(name))
+		}
+		return firstNonEmpty(os.Getenv(name), fromProfile)
+	}
+
+	config.infisicalServer = firstNonEmpty(config.infisicalServer, envOrProfile("INFISICAL_SERVER", profile.Server), fc.Server, defaultInfisicalServer)
+	config.projectID = firstNonEmpty(config.projectID, envOrProfile("INFISICAL_PROJECT_ID", profile.ProjectID), fc.ProjectID)
+	config.environment = firstNonEmpty(config.environment, envOrProfile("INFISICAL_ENVIRONMENT", profile.Environment), fc.Environment, defaultEnvironment)
+	config.secretPath = normalizeSecretPath(firstNonEmpty(config.secretPath, envOrProfile("INFISICAL_SECRET_PATH", profile.Path), fc.Path, defaultSecretPath))
+
+	if err := resolveAuthMethod(config, firstNonEmpty(profile.AuthMethod, fc.AuthMethod)); err != nil {
+		return err
+	}
+	config.identityID = firstNonEmpty(envOrProfile("INFISICAL_MACHINE_IDENTITY_ID", profile.IdentityID), fc.IdentityID)
+
+	if err := resolveCacheSettings(config, profile, fc); err != nil {
+		return err
+	}
+
+	if !config.explicit["warn-within"] {
+		config.expiryWarning = defaultExpiryWarning
+		if threshold := firstNonEmpty(profile.ExpiryWarning, fc.ExpiryWarning); threshold != "" {
+			duration, err := time.ParseDuration(threshold)
+			if err != nil {
+				return fmt.Errorf("invalid expiryWarning '%s': %v", threshold, err)
+			}
+			config.expiryWarning = duration
+		}
+	}
+
+	policy, lintOnUse, err := resolveLintPolicy(fc.Lint, profile.Lint)
+	if err != nil {
+		return err
+	}
+	config.lintPolicy = policy
+	if !config.explicit["lint"] {
+		config.lint = lintOnUse
+	}
+
+	if config.backups, err = backupRetention(fc); err != nil {
+		return err
+	}
+
+	// The profile output only applies to "ikube use" when no output was chosen on the command line
+	outputChosen := !config.profileOutput || config.temp || config.stdout || config.outputPath != ""
+	output := firstNonEmpty(profile.Output, fc.Output, outputKubeconfig)
+	switch output {
+	case outputKubeconfig:
+	case outputShell:
+		if !outputChosen {
+			config.temp = true
+		}
+	case outputStdout:
+		if !outputChosen {
+			config.stdout = true
+		}
+	default:
+		return fmt.Errorf("invalid output '%s', expected %s, %s or %s", output, outputKubeconfig, outputShell, outputStdout)
+	}
+
+	write := firstNonEmpty(profile.Write, fc.Write, writeMerge)
+	switch write {
+	case writeMerge:
+	case writeOverwrite:
+		if !config.explicit["overwrite"] {
+			config.overwrite = true
+		}
+	default:
+		return fmt.Errorf("invalid write '%s', expected %s or %s", write, writeMerge, writeOverwrite)
+	}
+
+	return nil
+}
+
+// resolveCacheSettings enables the offline cache for the commands supporting it,
+// when requested by flag or by the configuration file
+func resolveCacheSettings(config *appConfig, profile profileConfig, fc fileConfig) error {
+	if !config.cacheable {
+		config.cache = false
+		config.offline = false
+		return nil
+	}
+
+	if !config.explicit["cache"] {
+		for _, enabled := range []*bool{profile.Cache, fc.Cache} {
+			if enabled != nil {
+				config.cache = *enabled
+				break
+			}
+		}
+	}
+	if config.offline {
+		config.cache = true
+	}
+
+	if !config.explicit["cache-ttl"] {
+		ttl := firstNonEmpty(profile.CacheTTL, fc.CacheTTL)
+		if ttl == "" {
+			config.cacheTTL = defaultCacheTTL
+			return nil
+		}
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid cacheTTL '%s': %v", ttl, err)
+		}
+		config.cacheTTL = duration
+	}
+
+	return nil
+}
+
+// normalizeSecretPath turns a folder path into the absolute form expected by Infisical
+func normalizeSecretPath(secretPath string) string {
+	return path.Clean("/" + secretPath)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+	"github.com/zalando/go-keyring"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	execCredentialAPIVersion = "client.authentication.k8s.io/v1"
+	defaultCredentialTTL     = time.Hour
+
+	// credentialCachePrefix prefixes the keyring accounts caching the credentials served to kubectl
+	credentialCachePrefix = "exec-credential"
+)
+
+// execCredentialStatus holds the credentials returned to kubectl, as defined by client.authentication.k8s.io/v1
+type execCredentialStatus struct {
+	ExpirationTimestamp   *time.Time `json:"expirationTimestamp,omitempty"`
+	Token                 string     `json:"token,omitempty"`
+	ClientCertificateData string     `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string     `json:"clientKeyData,omitempty"`
+}
+
+type execCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+// cachedCredential is an ExecCredential kept in the keyring until CachedUntil
+type cachedCredential struct {
+	CachedUntil time.Time      `json:"cachedUntil"`
+	Credential  execCredential `json:"credential"`
+}
+
+// credentialCacheAccount identifies the cached credentials of a user of a stored kubeconfig in the keyring
+func credentialCacheAccount(name string, user string, config appConfig) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s/%s", credentialCachePrefix, config.infisicalServer, config.projectID, config.environment, path.Join(config.secretPath, name), user)
+}
+
+func loadCachedCredential(account string) (cachedCredential, bool) {
+	var cached cachedCredential
+
+	data, err := keyring.Get(keyringService, account)
+	if err != nil {
+		return cached, false
+	}
+	if err := json.Unmarshal([]byte(data), &cached); err != nil || time.Now().After(cached.CachedUntil) {
+		return cached, false
+	}
+	return cached, true
+}
+
+func saveCachedCredential(account string, cached cachedCredential) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keyringService, account, string(data))
+}
+
+// resolveCredentialUser returns the user of kubeCfg to serve: user when set, otherwise the user of the current context
+func resolveCredentialUser(kubeCfg *api.Config, user string) (string, error) {
+	if user != "" {
+		return user, nil
+	}
+	context, exists := kubeCfg.Contexts[kubeCfg.CurrentContext]
+	if !exists {
+		return "", fmt.Errorf("current-context '%s' not found in contexts", kubeCfg.CurrentContext)
+	}
+	return context.AuthInfo, nil
+}
+
+// credentialFor extracts the static credentials of a user of a stored kubeconfig as an ExecCredential,
+// expiring with the earliest of the token and client certificate
+func credentialFor(value string, user string) (execCredential, error) {
+	credential := execCredential{APIVersion: execCredentialAPIVersion, Kind: "ExecCredential"}
+
+	kubeCfg, err := clientcmd.Load([]byte(value))
+	if err != nil {
+		return credential, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+	user, err = resolveCredentialUser(kubeCfg, user)
+	if err != nil {
+		return credential, err
+	}
+	authInfo, exists := kubeCfg.AuthInfos[user]
+	if !exists {
+		return credential, fmt.Errorf("user '%s' not found in kubeconfig", user)
+	}
+
+	var expiries []time.Time
+	switch {
+	case authInfo.Exec != nil || authInfo.AuthProvider != nil:
+		return credential, fmt.Errorf("user '%s' already authenticates with a credential plugin", user)
+	case len(authInfo.ClientCertificateData) > 0 && len(authInfo.ClientKeyData) > 0:
+		credential.Status.ClientCertificateData = string(authInfo.ClientCertificateData)
+		credential.Status.ClientKeyData = string(authInfo.ClientKeyData)
+		if expiry, ok := certificateExpiry(authInfo.ClientCertificateData); ok {
+			expiries = append(expiries, expiry)
+		}
+	}
+	if authInfo.Token != "" {
+		credential.Status.Token = authInfo.Token
+		if expiry, ok := tokenExpiry(authInfo.Token); ok {
+			expiries = append(expiries, expiry)
+		}
+	}
+	if credential.Status.Token == "" && credential.Status.ClientCertificateData == "" {
+		return credential, fmt.Errorf("user '%s' has no token or client certificate", user)
+	}
+
+	for _, expiry := range expiries {
+		if credential.Status.ExpirationTimestamp == nil || expiry.Before(*credential.Status.ExpirationTimestamp) {
+			expiry := expiry.UTC().Truncate(time.Second)
+			credential.Status.ExpirationTimestamp = &expiry
+		}
+	}
+	return credential, nil
+}
+
+// execKubeconfig rewrites a stored kubeconfig so that every user with static credentials gets them
+// from "ikube credential" instead. The result holds no secret material.
+func execKubeconfig(value string, name string, config appConfig) ([]byte, error) {
+	kubeCfg, err := clientcmd.Load([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+
+	args := []string{"credential"}
+	if profile := firstNonEmpty(config.profile, os.Getenv("IKUBE_PROFILE")); profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	if config.explicit["auth-method"] {
+		args = append(args, "--auth-method", config.authMethod)
+	}
+	args = append(args, "--env", config.environment, "--path", config.secretPath)
+
+	for user, authInfo := range kubeCfg.AuthInfos {
+		if authInfo.Exec != nil || authInfo.AuthProvider != nil {
+			continue
+		}
+		kubeCfg.AuthInfos[user] = &api.AuthInfo{
+			Exec: &api.ExecConfig{
+				APIVersion: execCredentialAPIVersion,
+				Command:    "ikube",
+				Args:       append(append([]string{}, args...), "--user", user, name),
+				Env: []api.ExecEnvVar{
+					{Name: "INFISICAL_SERVER", Value: config.infisicalServer},
+					{Name: "INFISICAL_PROJECT_ID", Value: config.projectID},
+				},
+				InteractiveMode: api.IfAvailableExecInteractiveMode,
+			},
+		}
+	}
+
+	return clientcmd.Write(*kubeCfg)
+}
+
+// handleInstallCredential writes the kubeconfig named name with its users replaced by "ikube credential",
+// like "ikube use" does with the kubeconfig itself
+func handleInstallCredential(client infisical.InfisicalClientInterface, projectID string, name string, config appConfig) {
+	secret := findKubeconfig(client, projectID, name, config)
+	guardKubeconfig(secret, config)
+
+	data, err := execKubeconfig(secret.SecretValue, secretName(secret, config.secretPath), config)
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error building kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error building kubeconfig")
+		}
+		exit(1)
+	}
+
+	secret.SecretValue = string(data)
+	writeSelectedKubeconfig(secret, config)
+}
+
+// handleCredential prints the ExecCredential of the kubeconfig named name to out, serving it from the
+// keyring cache when possible so that Infisical is only contacted when the credentials are needed
+func handleCredential(ctx context.Context, out io.Writer, name string, config appConfig) {
+	loadSettings(&config)
+
+	account := credentialCacheAccount(name, config.credentialUser, config)
+	cached, ok := loadCachedCredential(account)
+	if !ok {
+		client, projectID := connectResolved(ctx, config)
+		secret := findKubeconfig(client, projectID, name, config)
+		guardKubeconfig(secret, config)
+
+		credential, err := credentialFor(secret.SecretValue, config.credentialUser)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Cannot provide credentials for %s: %v\n", name, err)
+			exit(1)
+		}
+
+		cached = cachedCredential{Credential: credential}
+		if config.credentialTTL > 0 {
+			cached.CachedUntil = time.Now().Add(config.credentialTTL).UTC().Truncate(time.Second)
+			if expiry := credential.Status.ExpirationTimestamp; expiry != nil && expiry.Before(cached.CachedUntil) {
+				cached.CachedUntil = *expiry
+			}
+			if err := saveCachedCredential(account, cached); err != nil && config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to cache credentials: %v\n", err)
+			}
+		}
+	}
+
+	// Have kubectl ask again once the cache expires, so that rotated credentials are picked up
+	credential := cached.Credential
+	if !cached.CachedUntil.IsZero() {
+		credential.Status.ExpirationTimestamp = &cached.CachedUntil
+	}
+
+	if err := json.NewEncoder(out).Encode(credential); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding credentials: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+)
+
+// lineDiff returns a line-based diff between a and b, with removed lines prefixed by "-",
+// added lines by "+" and unchanged lines by a space. It returns an empty string when a and b are equal.
+func lineDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	left := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	right := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] holds the length of the longest common subsequence of left[i:] and right[j:]
+	lcs := make([][]int, len(left)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(right)+1)
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		for j := len(right) - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+		switch {
+		case left[i] == right[j]:
+			sb.WriteString(" " + left[i] + "\n")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			sb.WriteString("-" + left[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + right[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(left); i++ {
+		sb.WriteString("-" + left[i] + "\n")
+	}
+	for ; j < len(right); j++ {
+		sb.WriteString("+" + right[j] + "\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	infisical "github.com/infisical/go-sdk"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// forwardSignals relays the termination signals received by ikube to the running commands
+// until the returned function is called. SIGINT is not relayed: the terminal already sends it
+// to the whole foreground process group, commands included.
+func forwardSignals(cmds ...*exec.Cmd) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				for _, cmd := range cmds {
+					if cmd.Process != nil {
+						_ = cmd.Process.Signal(sig)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// exitCode returns the exit code of a finished command, using the shell convention of 128 + signal
+// number for commands killed by a signal
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 127
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// prefixWriter writes complete lines to out, each prefixed with the cluster name,
+// so that the output of commands running in parallel does not interleave mid-line
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.writeLine(w.buf[:idx+1])
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line when it was not terminated by a newline
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+}
+
+// selectKubeconfigs lets the user pick several of the stored kubeconfigs matching filter
+func selectKubeconfigs(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) []infisical.Secret {
+	secrets, cachedAt := fetchKubeconfigs(client, projectID, filter, config)
+	previewer := newKubeconfigPreviewer(client, projectID, cachedAt, config)
+
+	indices, err := fuzzyfinder.FindMulti(
+		secrets,
+		func(i int) string {
+			return secretName(secrets[i], config.secretPath)
+		},
+		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
+			if i == -1 {
+				return ""
+			}
+			return previewer.render(secrets[i])
+		}),
+	)
+
+	if err != nil {
+		if err == fuzzyfinder.ErrAbort {
+			fmt.Fprintln(os.Stderr, "Selection cancelled")
+			exit(0)
+		}
+		if config.verbose {
+			fmt.Printf("Error during selection: %v\n", err)
+		} else {
+			fmt.Println("Error during selection")
+		}
+		exit(1)
+	}
+
+	selected := make([]infisical.Secret, 0, len(indices))
+	for _, idx := range indices {
+		selected = append(selected, secrets[idx])
+	}
+	return selected
+}
+
+// runWithKubeconfig runs command attached to the terminal with KUBECONFIG pointing at a temporary
+// copy of secret, and returns its exit code
+func runWithKubeconfig(secret infisical.Secret, command []string, config appConfig) int {
+	tmpPath, err := createTempKubeconfig([]byte(secret.SecretValue))
+	if err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Error creating temporary kubeconfig: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error creating temporary kubeconfig")
+		}
+		return 1
+	}
+	defer removeTempKubeconfig(tmpPath)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", tmpPath))
+
+	if err := cmd.Start(); err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Error running %s: %v\n", command[0], err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error running %s\n", command[0])
+		}
+		return 127
+	}
+
+	defer trackChild()()
+	stop := forwardSignals(cmd)
+	defer stop()
+
+	return exitCode(cmd.Wait())
+}
+
+// runWithKubeconfigs runs command against every secret in parallel, prefixing each output line
+// with the cluster name. It returns 0 when every command succeeded and 1 otherwise.
+func runWithKubeconfigs(secrets []infisical.Secret, command []string, config appConfig) int {
+	var mu sync.Mutex
+	cmds := make([]*exec.Cmd, len(secrets))
+	writers := make([]*prefixWriter, 0, 2*len(secrets))
+	codes := make([]int, len(secrets))
+
+	for i, secret := range secrets {
+		name := secretName(secret, config.secretPath)
+		tmpPath, err := createTempKubeconfig([]byte(secret.SecretValue))
+		if err != nil {
+			if config.verbose {
+				fmt.Fprintf(os.Stderr, "[%s] Error creating temporary kubeconfig: %v\n", name, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "[%s] Error creating temporary kubeconfig\n", name)
+			}
+			codes[i] = 1
+			continue
+		}
+		defer removeTempKubeconfig(tmpPath)
+
+		stdout := &prefixWriter{mu: &mu, out: os.Stdout, prefix: fmt.Sprintf("[%s] ", name)}
+		stderr := &prefixWriter{mu: &mu, out: os.Stderr, prefix: fmt.Sprintf("[%s] ", name)}
+		writers = append(writers, stdout, stderr)
+
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", tmpPath))
+		if err := cmd.Start(); err != nil {
+			if config.verbose {
+				fmt.Fprintf(os.Stderr, "[%s] Error running %s: %v\n", name, command[0], err)
+			} else {
+				fmt.Fprintf(os.Stderr, "[%s] Error running %s\n", name, command[0])
+			}
+			codes[i] = 127
+			continue
+		}
+		cmds[i] = cmd
+	}
+
+	started := slices.DeleteFunc(slices.Clone(cmds), func(cmd *exec.Cmd) bool {
+		return cmd == nil
+	})
+	defer trackChild()()
+	stop := forwardSignals(started...)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = exitCode(cmd.Wait())
+		}()
+	}
+	wg.Wait()
+
+	for _, w := range writers {
+		w.Flush()
+	}
+
+	failed := 0
+	for i, code := range codes {
+		if code != 0 {
+			fmt.Fprintf(os.Stderr, "[%s] exited with code %d\n", secretName(secrets[i], config.secretPath), code)
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d clusters failed\n", failed, len(secrets))
+		return 1
+	}
+	return 0
+}
+
+func handleExec(client infisical.InfisicalClientInterface, projectID string, names []string, command []string, config appConfig) {
+	var secrets []infisical.Secret
+	switch {
+	case config.multi:
+		filter := ""
+		if len(names) > 0 {
+			filter = strings.ToLower(names[0])
+		}
+		secrets = selectKubeconfigs(client, projectID, filter, config)
+	case len(names) == 0:
+		secret, ok := selectKubeconfig(client, projectID, "", config)
+		if !ok {
+			return
+		}
+		secrets = []infisical.Secret{secret}
+	default:
+		for _, name := range names {
+			secrets = append(secrets, findKubeconfig(client, projectID, name, config))
+		}
+	}
+
+	if len(secrets) == 0 {
+		fmt.Fprintln(os.Stderr, "No clusters selected")
+		return
+	}
+	for _, secret := range secrets {
+		guardKubeconfig(secret, config)
+	}
+
+	if len(secrets) == 1 && !config.multi {
+		exit(runWithKubeconfig(secrets[0], command, config))
+	}
+	exit(runWithKubeconfigs(secrets, command, config))
+}
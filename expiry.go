@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+)
+
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// credentialExpiry is the expiry date of a certificate or token of a kubeconfig context
+type credentialExpiry struct {
+	context string
+	what    string
+	expiry  time.Time
+}
+
+// credentialExpiries lists the expiry dates of the certificates and tokens embedded in a kubeconfig
+func credentialExpiries(summary kubeconfigSummary) []credentialExpiry {
+	var expiries []credentialExpiry
+	for _, context := range summary.Contexts {
+		for _, e := range []credentialExpiry{
+			{context.Name, "client certificate", context.ClientCertExpiry},
+			{context.Name, "CA certificate", context.CAExpiry},
+			{context.Name, "token", context.TokenExpiry},
+		} {
+			if !e.expiry.IsZero() {
+				expiries = append(expiries, e)
+			}
+		}
+	}
+	return expiries
+}
+
+// formatExpiry renders an expiry date with the time left, flagging it when under the warning threshold
+func formatExpiry(expiry time.Time, threshold time.Duration) string {
+	left := time.Until(expiry)
+	switch {
+	case left <= 0:
+		return fmt.Sprintf("%s (EXPIRED)", expiry.Local().Format(time.DateTime))
+	case left < threshold:
+		return fmt.Sprintf("%s (in %d days, EXPIRES SOON)", expiry.Local().Format(time.DateTime), int(left.Hours()/24))
+	default:
+		return fmt.Sprintf("%s (in %d days)", expiry.Local().Format(time.DateTime), int(left.Hours()/24))
+	}
+}
+
+// guardExpiry warns on stderr about the credentials of secret expiring within the warning threshold
+// and exits when some already expired, unless --force is set
+func guardExpiry(secret infisical.Secret, config appConfig) {
+	summary, err := summarizeKubeconfig(secret.SecretValue)
+	if err != nil {
+		return
+	}
+
+	name := secretName(secret, config.secretPath)
+	expired := false
+	for _, e := range credentialExpiries(summary) {
+		left := time.Until(e.expiry)
+		switch {
+		case left <= 0:
+			expired = true
+			fmt.Fprintf(os.Stderr, "WARNING: The %s of cluster %s (context %s) EXPIRED on %s\n", e.what, name, e.context, e.expiry.Local().Format(time.DateTime))
+		case left < config.expiryWarning:
+			fmt.Fprintf(os.Stderr, "WARNING: The %s of cluster %s (context %s) expires in %d days, on %s\n", e.what, name, e.context, int(left.Hours()/24), e.expiry.Local().Format(time.DateTime))
+		}
+	}
+
+	if expired && !config.force {
+		fmt.Fprintf(os.Stderr, "Error: Cluster %s has expired credentials, use --force to use them anyway\n", name)
+		exit(1)
+	}
+}
+
+// guardKubeconfig runs the checks due before handing out the kubeconfig of secret: the expiry of its
+// credentials and, when enabled, the validation policy
+func guardKubeconfig(secret infisical.Secret, config appConfig) {
+	guardExpiry(secret, config)
+	if config.lint {
+		guardLint(secret, config)
+	}
+}
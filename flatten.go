@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// flattenFile reads the file referenced by path into data and clears path.
+// When data is already set it takes precedence, as it does in client-go, and path is only cleared.
+func flattenFile(path *string, data *[]byte, baseDir string) error {
+	if *path == "" {
+		return nil
+	}
+
+	if len(*data) == 0 {
+		content, err := os.ReadFile(api.ResolvePath(*path, baseDir))
+		if err != nil {
+			return err
+		}
+		*data = content
+	}
+
+	*path = ""
+	return nil
+}
+
+// flattenKubeconfig embeds the certificate, key and token files referenced by kubeCfg into the kubeconfig,
+// like "kubectl config view --flatten", resolving relative paths against baseDir.
+// It returns one error per reference that could not be resolved, leaving those references in place.
+func flattenKubeconfig(kubeCfg *api.Config, baseDir string) []error {
+	var errs []error
+
+	for name, cluster := range kubeCfg.Clusters {
+		if err := flattenFile(&cluster.CertificateAuthority, &cluster.CertificateAuthorityData, baseDir); err != nil {
+			errs = append(errs, fmt.Errorf("cluster '%s': certificate-authority: %v", name, err))
+		}
+	}
+
+	for name, authInfo := range kubeCfg.AuthInfos {
+		if err := flattenFile(&authInfo.ClientCertificate, &authInfo.ClientCertificateData, baseDir); err != nil {
+			errs = append(errs, fmt.Errorf("user '%s': client-certificate: %v", name, err))
+		}
+		if err := flattenFile(&authInfo.ClientKey, &authInfo.ClientKeyData, baseDir); err != nil {
+			errs = append(errs, fmt.Errorf("user '%s': client-key: %v", name, err))
+		}
+
+		if authInfo.TokenFile != "" {
+			if authInfo.Token == "" {
+				token, err := os.ReadFile(api.ResolvePath(authInfo.TokenFile, baseDir))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("user '%s': tokenFile: %v", name, err))
+					continue
+				}
+				authInfo.Token = strings.TrimSpace(string(token))
+			}
+			authInfo.TokenFile = ""
+		}
+	}
+
+	return errs
+}
+
+// flattenStoredKubeconfig embeds the files referenced by a kubeconfig about to be stored,
+// so that it does not depend on this machine, and exits when some cannot be resolved
+func flattenStoredKubeconfig(kubeCfg *api.Config, config appConfig) {
+	baseDir, err := inputBaseDir(config)
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error getting current directory: %v\n", err)
+		} else {
+			fmt.Println("Error getting current directory")
+		}
+		exit(1)
+	}
+
+	if errs := flattenKubeconfig(kubeCfg, baseDir); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("Warning: Cannot resolve %v\n", err)
+		}
+		if !config.allowUnresolved {
+			fmt.Println("Error: Kubeconfig references files that cannot be resolved, use --allow-unresolved to store it anyway")
+			exit(1)
+		}
+	}
+}
+
+// inputBaseDir returns the directory relative paths of the imported kubeconfig are resolved against:
+// the directory of the file given with -f, or the current directory for stdin
+func inputBaseDir(config appConfig) (string, error) {
+	if config.file != "" {
+		absPath, err := filepath.Abs(config.file)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Dir(absPath), nil
+	}
+	return os.Getwd()
+}
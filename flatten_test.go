@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestFlattenKubeconfig(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(baseDir, "certs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"certs/ca.crt":     "ca",
+		"certs/client.crt": "cert",
+		"certs/client.key": "key",
+		"token":            "token\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(baseDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		cluster  api.Cluster
+		authInfo api.AuthInfo
+		wantCA   string
+		wantCert string
+		wantKey  string
+		// wantToken is the token once flattened, and wantErrs the number of unresolved references
+		wantToken string
+		wantErrs  int
+	}{
+		{
+			name:     "relative paths",
+			cluster:  api.Cluster{CertificateAuthority: "certs/ca.crt"},
+			authInfo: api.AuthInfo{ClientCertificate: "certs/client.crt", ClientKey: "./certs/client.key"},
+			wantCA:   "ca",
+			wantCert: "cert",
+			wantKey:  "key",
+		},
+		{
+			name:     "absolute paths",
+			cluster:  api.Cluster{CertificateAuthority: filepath.Join(baseDir, "certs/ca.crt")},
+			authInfo: api.AuthInfo{ClientCertificate: filepath.Join(baseDir, "certs/client.crt")},
+			wantCA:   "ca",
+			wantCert: "cert",
+		},
+		{
+			name:      "token file is trimmed",
+			authInfo:  api.AuthInfo{TokenFile: "token"},
+			wantToken: "token",
+		},
+		{
+			name:      "inline data takes precedence",
+			cluster:   api.Cluster{CertificateAuthority: "certs/ca.crt", CertificateAuthorityData: []byte("inline")},
+			wantCA:    "inline",
+			authInfo:  api.AuthInfo{TokenFile: "missing", Token: "inline"},
+			wantToken: "inline",
+		},
+		{
+			name:     "missing files",
+			cluster:  api.Cluster{CertificateAuthority: "missing/ca.crt"},
+			authInfo: api.AuthInfo{ClientKey: "missing/client.key", TokenFile: "missing/token"},
+			wantErrs: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeCfg := api.NewConfig()
+			cluster, authInfo := tt.cluster, tt.authInfo
+			kubeCfg.Clusters["prod"] = &cluster
+			kubeCfg.AuthInfos["prod"] = &authInfo
+
+			errs := flattenKubeconfig(kubeCfg, baseDir)
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("flattenKubeconfig() returned %d errors, want %d: %v", len(errs), tt.wantErrs, errs)
+			}
+			if tt.wantErrs > 0 {
+				// Unresolved references are left in place
+				if cluster.CertificateAuthority != tt.cluster.CertificateAuthority || authInfo.TokenFile != tt.authInfo.TokenFile {
+					t.Errorf("unresolved references were cleared")
+				}
+				return
+			}
+
+			if cluster.CertificateAuthority != "" || authInfo.ClientCertificate != "" || authInfo.ClientKey != "" || authInfo.TokenFile != "" {
+				t.Errorf("file references were not cleared")
+			}
+			if string(cluster.CertificateAuthorityData) != tt.wantCA {
+				t.Errorf("certificate-authority-data = %q, want %q", cluster.CertificateAuthorityData, tt.wantCA)
+			}
+			if string(authInfo.ClientCertificateData) != tt.wantCert {
+				t.Errorf("client-certificate-data = %q, want %q", authInfo.ClientCertificateData, tt.wantCert)
+			}
+			if string(authInfo.ClientKeyData) != tt.wantKey {
+				t.Errorf("client-key-data = %q, want %q", authInfo.ClientKeyData, tt.wantKey)
+			}
+			if authInfo.Token != tt.wantToken {
+				t.Errorf("token = %q, want %q", authInfo.Token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestFlattenOnlyStoredContexts(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(baseDir, "ca.crt"), []byte("ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeCfg := testKubeconfig("good", "https://good:6443", "t1")
+	kubeCfg.Clusters["good"].CertificateAuthority = "ca.crt"
+	kubeCfg.Clusters["bad"] = &api.Cluster{Server: "https://bad:6443", CertificateAuthority: "missing.crt"}
+	kubeCfg.Contexts["bad"] = &api.Context{Cluster: "bad", AuthInfo: "good"}
+
+	// The context of a missing file must not prevent storing the other one, as with --split
+	extracted, err := extractContext(kubeCfg, "good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := flattenKubeconfig(extracted, baseDir); len(errs) != 0 {
+		t.Fatalf("flattenKubeconfig() errors = %v", errs)
+	}
+	if string(extracted.Clusters["good"].CertificateAuthorityData) != "ca" {
+		t.Errorf("certificate-authority-data = %q, want %q", extracted.Clusters["good"].CertificateAuthorityData, "ca")
+	}
+}
+
+func TestStoreFileReferencedCredentials(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"ca.crt": "ca", "client.crt": "cert", "client.key": "key"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A minikube-style kubeconfig, whose credentials are only file references
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: minikube
+clusters:
+- name: minikube
+  cluster:
+    server: https://192.168.49.2:8443
+    certificate-authority: ca.crt
+users:
+- name: minikube
+  user:
+    client-certificate: client.crt
+    client-key: client.key
+contexts:
+- name: minikube
+  context:
+    cluster: minikube
+    user: minikube
+`
+	file := filepath.Join(dir, "config")
+	if err := os.WriteFile(file, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entries func(kubeCfg *api.Config, config appConfig) []kubeconfigEntry
+	}{
+		{
+			name: "minified",
+			entries: func(kubeCfg *api.Config, config appConfig) []kubeconfigEntry {
+				return []kubeconfigEntry{singleKubeconfigEntry(kubeCfg, config)}
+			},
+		},
+		{
+			name: "split",
+			entries: func(kubeCfg *api.Config, config appConfig) []kubeconfigEntry {
+				config.split = true
+				config.contexts = "minikube"
+				return splitKubeconfig(kubeCfg, config)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeCfg, err := clientcmd.Load([]byte(kubeconfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries := tt.entries(kubeCfg, appConfig{file: file})
+			if len(entries) != 1 || entries[0].key != "minikube" {
+				t.Fatalf("got entries %+v, want one named minikube", entries)
+			}
+
+			stored, err := clientcmd.Load([]byte(entries[0].value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			authInfo := stored.AuthInfos["minikube"]
+			if authInfo.ClientCertificate != "" || string(authInfo.ClientCertificateData) != "cert" || string(authInfo.ClientKeyData) != "key" {
+				t.Errorf("credentials were not embedded: %+v", authInfo)
+			}
+			if string(stored.Clusters["minikube"].CertificateAuthorityData) != "ca" {
+				t.Errorf("certificate authority was not embedded")
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	infisical "github.com/infisical/go-sdk"
+)
+
+const (
+	// exitNotFound is returned when no kubeconfig has the requested name
+	exitNotFound = 3
+	// exitAmbiguous is returned when several kubeconfigs in different folders have the requested name
+	exitAmbiguous = 4
+)
+
+// findKubeconfig returns the stored kubeconfig named exactly name, without any interaction.
+// The name is matched against the full name including folders (e.g. "eu/prod/cluster-a"), then against
+// the bare secret key. It exits with exitNotFound or exitAmbiguous when there is no single match.
+func findKubeconfig(client infisical.InfisicalClientInterface, projectID string, name string, config appConfig) infisical.Secret {
+	secrets, _ := retrieveSecrets(client, projectID, config)
+
+	for _, secret := range secrets {
+		if secretName(secret, config.secretPath) == name {
+			return secret
+		}
+	}
+
+	var matches []infisical.Secret
+	for _, secret := range secrets {
+		if secret.SecretKey == name {
+			matches = append(matches, secret)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		fmt.Fprintf(os.Stderr, "Error: No kubeconfig named %s\n", name)
+		exit(exitNotFound)
+	case 1:
+		return matches[0]
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: Several kubeconfigs are named %s, use the full name:\n", name)
+	for _, secret := range matches {
+		fmt.Fprintf(os.Stderr, "- %s\n", secretName(secret, config.secretPath))
+	}
+	exit(exitAmbiguous)
+	return infisical.Secret{}
+}
+
+// writeKubeconfigOutput writes a kubeconfig to path with 0600 permissions, creating its directory if needed
+func writeKubeconfigOutput(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", path, err)
+	}
+	return writeFileAtomic(path, content, 0600)
+}
+
+func handleGetKubeconfig(client infisical.InfisicalClientInterface, projectID string, name string, config appConfig) {
+	secret := findKubeconfig(client, projectID, name, config)
+	guardKubeconfig(secret, config)
+
+	if config.outputPath == "" {
+		fmt.Print(secret.SecretValue)
+		return
+	}
+
+	if err := writeKubeconfigOutput(config.outputPath, []byte(secret.SecretValue)); err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Error writing kubeconfig: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error writing kubeconfig")
+		}
+		exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully wrote kubeconfig for cluster %s to %s\n", secretName(secret, config.secretPath), config.outputPath)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	infisical "github.com/infisical/go-sdk"
+)
+
+// kubeconfigEnvVar records the session kubeconfig of a shell in hook mode, so that it is
+// removed when switching clusters and when the shell exits
+const kubeconfigEnvVar = "IKUBE_KUBECONFIG"
+
+// hookShells are the shells supported by env and init
+var hookShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// defaultHookShell returns the shell named by $SHELL when it is supported, bash otherwise
+func defaultHookShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if slices.Contains(hookShells, shell) {
+		return shell
+	}
+	return "bash"
+}
+
+// quoteShell quotes value so that shell reads it back verbatim
+func quoteShell(shell string, value string) string {
+	switch shell {
+	case "fish":
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+	case "powershell":
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+}
+
+// exportStatement returns the statement setting the environment variable name in shell
+func exportStatement(shell string, name string, value string) string {
+	switch shell {
+	case "fish":
+		return fmt.Sprintf("set -gx %s %s;", name, quoteShell(shell, value))
+	case "powershell":
+		return fmt.Sprintf("$env:%s = %s", name, quoteShell(shell, value))
+	default:
+		return fmt.Sprintf("export %s=%s;", name, quoteShell(shell, value))
+	}
+}
+
+// isSessionKubeconfig reports whether path is a kubeconfig of the runtime directory owned by sessionPID
+func isSessionKubeconfig(path string, sessionPID int) bool {
+	dir, err := runtimeDir()
+	if err != nil || path == "" {
+		return false
+	}
+	return filepath.Dir(path) == dir &&
+		strings.HasPrefix(filepath.Base(path), fmt.Sprintf("%s%d-", tempKubeconfigPrefix, sessionPID))
+}
+
+// handleEnvKubeconfig writes the selected kubeconfig to a file owned by the calling shell session and prints
+// the statements pointing KUBECONFIG at it. The file outlives ikube: it is removed by the shell hook when
+// the shell exits, or swept by a later ikube run once the session process is gone.
+func handleEnvKubeconfig(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
+	if !slices.Contains(hookShells, config.shell) {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported shell %s, use one of %s\n", config.shell, strings.Join(hookShells, ", "))
+		exit(2)
+	}
+
+	selectedSecret, ok := selectKubeconfig(client, projectID, filter, config)
+	if !ok {
+		// Fail so that the shell hook does not evaluate the output
+		exit(1)
+	}
+
+	guardKubeconfig(selectedSecret, config)
+	if config.verify && !verifyKubeconfig(selectedSecret, config) {
+		exit(1)
+	}
+
+	path, err := createOwnedKubeconfig([]byte(selectedSecret.SecretValue), config.sessionPID)
+	if err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Error creating session kubeconfig: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error creating session kubeconfig")
+		}
+		exit(1)
+	}
+
+	// Only one kubeconfig per session: drop the one of the previous cluster
+	if previous := os.Getenv(kubeconfigEnvVar); isSessionKubeconfig(previous, config.sessionPID) {
+		os.Remove(previous)
+	}
+
+	name := secretName(selectedSecret, config.secretPath)
+	fmt.Println(exportStatement(config.shell, "KUBECONFIG", path))
+	fmt.Println(exportStatement(config.shell, kubeconfigEnvVar, path))
+	fmt.Println(exportStatement(config.shell, clusterEnvVar, name))
+	fmt.Println(exportStatement(config.shell, sessionEnvVar, fmt.Sprint(config.sessionPID)))
+
+	fmt.Fprintf(os.Stderr, "Switched this shell to cluster: %s\n", name)
+}
+
+// bashExitTrap chains the cleanup onto the EXIT trap the shell may already have, since bash keeps a single one.
+// "trap -p" prints the current trap as a quoted command, which "set --" splits back into its words.
+const bashExitTrap = `__ikube_chain_exit_trap() {
+  eval "set -- $(trap -p EXIT)"
+  case "$3" in
+    *__ikube_cleanup*) ;;
+    "") trap '__ikube_cleanup' EXIT ;;
+    *) trap "__ikube_cleanup; $3" EXIT ;;
+  esac
+}
+__ikube_chain_exit_trap
+unset -f __ikube_chain_exit_trap`
+
+// hookSnippets define an ikube function that turns "ikube use -l" into "ikube env" evaluated in the current
+// shell, and remove the session kubeconfig when the shell exits. Other commands are passed through.
+var hookSnippets = map[string]string{
+	"bash": posixHook("bash", bashExitTrap),
+	"zsh":  posixHook("zsh", "autoload -Uz add-zsh-hook\nadd-zsh-hook zshexit __ikube_cleanup"),
+	"fish": `function ikube --wraps ikube --description 'ikube with "use -l" switching the current shell'
+  set -l args $argv
+  if set -q args[1]; and test "$args[1]" = use
+    set -e args[1]
+  else if set -q args[1]; and not string match -q -- '-*' $args[1]
+    command ikube $argv
+    return
+  end
+  set -l hook 0
+  set -l rest
+  for arg in $args
+    if string match -qr -- '^--?l(=true)?$' $arg
+      set hook 1
+    else
+      set -a rest $arg
+    end
+  end
+  if test $hook = 0
+    command ikube $argv
+    return
+  end
+  set -l out (command ikube env --shell fish --session-pid $fish_pid $rest)
+  or begin
+    test -n "$out"; and printf '%s\n' $out >&2
+    return 1
+  end
+  printf '%s\n' $out | source
+end
+
+function __ikube_cleanup --on-event fish_exit
+  set -q IKUBE_KUBECONFIG; and rm -f $IKUBE_KUBECONFIG
+end
+`,
+	"powershell": `$global:__IkubeBin = (Get-Command ikube -CommandType Application | Select-Object -First 1).Source
+
+function ikube {
+  $rest = @($args)
+  if ($rest.Count -gt 0 -and $rest[0] -eq 'use') {
+    $rest = @($rest | Select-Object -Skip 1)
+  } elseif ($rest.Count -gt 0 -and -not "$($rest[0])".StartsWith('-')) {
+    & $global:__IkubeBin @args
+    return
+  }
+  if (@($rest | Where-Object { $_ -match '^--?l(=true)?$' }).Count -eq 0) {
+    & $global:__IkubeBin @args
+    return
+  }
+  $rest = @($rest | Where-Object { $_ -notmatch '^--?l(=true)?$' })
+  $out = & $global:__IkubeBin env --shell powershell --session-pid $PID @rest
+  if ($LASTEXITCODE -ne 0) {
+    if ($out) { $out | Write-Error }
+    return
+  }
+  Invoke-Expression ($out -join "` + "`" + `n")
+}
+
+Register-EngineEvent PowerShell.Exiting -Action {
+  if ($env:IKUBE_KUBECONFIG) { Remove-Item -Force -ErrorAction SilentlyContinue $env:IKUBE_KUBECONFIG }
+} | Out-Null
+`,
+}
+
+// posixHook returns the hook of bash and zsh, which only differ by how they run code on exit
+func posixHook(shell string, onExit string) string {
+	return `ikube() {
+  case "$1" in
+    use) shift ;;
+    -*|"") ;;
+    *) command ikube "$@"; return ;;
+  esac
+  local hook=0 arg out
+  local -a rest
+  rest=()
+  for arg in "$@"; do
+    case "$arg" in
+      -l|--l|-l=true|--l=true) hook=1 ;;
+      *) rest+=("$arg") ;;
+    esac
+  done
+  if [ "$hook" = 0 ]; then
+    command ikube use "$@"
+    return
+  fi
+  out="$(command ikube env --shell ` + shell + ` --session-pid $$ "${rest[@]}")" || {
+    [ -n "$out" ] && printf '%s\n' "$out" >&2
+    return 1
+  }
+  eval "$out"
+}
+
+__ikube_cleanup() {
+  [ -n "$IKUBE_KUBECONFIG" ] && rm -f "$IKUBE_KUBECONFIG"
+}
+` + onExit + "\n"
+}
+
+func handleInit(shell string) {
+	snippet, ok := hookSnippets[shell]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported shell %s, use one of %s\n", shell, strings.Join(hookShells, ", "))
+		exit(2)
+	}
+
+	fmt.Print(snippet)
+}
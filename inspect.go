@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	authTypeExec         = "exec"
+	authTypeAuthProvider = "auth-provider"
+	authTypeCertificate  = "client-certificate"
+	authTypeToken        = "token"
+	authTypeBasic        = "basic"
+	authTypeNone         = "none"
+)
+
+// contextSummary describes a context of a kubeconfig without any secret material
+type contextSummary struct {
+	Name      string
+	Cluster   string
+	Server    string
+	Namespace string
+	User      string
+	AuthType  string
+	// ExecCommand is the credential plugin run by exec users
+	ExecCommand string
+	// ClientCertExpiry and CAExpiry are zero when there is no embedded certificate
+	ClientCertExpiry time.Time
+	CAExpiry         time.Time
+	// TokenExpiry is zero unless the user has a bearer token that is a JWT with an expiry
+	TokenExpiry time.Time
+}
+
+// kubeconfigSummary describes a stored kubeconfig without any secret material
+type kubeconfigSummary struct {
+	CurrentContext string
+	Contexts       []contextSummary
+}
+
+// authType returns how a user authenticates against the API server
+func authType(authInfo *api.AuthInfo) string {
+	switch {
+	case authInfo == nil:
+		return authTypeNone
+	case authInfo.Exec != nil:
+		return authTypeExec
+	case authInfo.AuthProvider != nil:
+		return authTypeAuthProvider
+	case len(authInfo.ClientCertificateData) > 0 || authInfo.ClientCertificate != "":
+		return authTypeCertificate
+	case authInfo.Token != "" || authInfo.TokenFile != "":
+		return authTypeToken
+	case authInfo.Username != "" || authInfo.Password != "":
+		return authTypeBasic
+	default:
+		return authTypeNone
+	}
+}
+
+// certificateExpiry returns the earliest expiry of the PEM certificates in data, which may hold a bundle
+func certificateExpiry(data []byte) (time.Time, bool) {
+	var expiry time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry, !expiry.IsZero()
+}
+
+// tokenExpiry returns the expiry of a JWT bearer token, such as a service account token
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+// summarizeKubeconfig parses a stored kubeconfig and describes its contexts, sorted by name
+func summarizeKubeconfig(value string) (kubeconfigSummary, error) {
+	kubeCfg, err := clientcmd.Load([]byte(value))
+	if err != nil {
+		return kubeconfigSummary{}, err
+	}
+
+	summary := kubeconfigSummary{CurrentContext: kubeCfg.CurrentContext}
+	for name, context := range kubeCfg.Contexts {
+		ctx := contextSummary{
+			Name:      name,
+			Cluster:   context.Cluster,
+			Namespace: context.Namespace,
+			User:      context.AuthInfo,
+			AuthType:  authType(kubeCfg.AuthInfos[context.AuthInfo]),
+		}
+		if cluster, exists := kubeCfg.Clusters[context.Cluster]; exists {
+			ctx.Server = cluster.Server
+			ctx.CAExpiry, _ = certificateExpiry(cluster.CertificateAuthorityData)
+		}
+		if authInfo, exists := kubeCfg.AuthInfos[context.AuthInfo]; exists {
+			ctx.ClientCertExpiry, _ = certificateExpiry(authInfo.ClientCertificateData)
+			ctx.TokenExpiry, _ = tokenExpiry(authInfo.Token)
+			if authInfo.Exec != nil {
+				ctx.ExecCommand = authInfo.Exec.Command
+			}
+		}
+		summary.Contexts = append(summary.Contexts, ctx)
+	}
+	slices.SortFunc(summary.Contexts, func(a, b contextSummary) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return summary, nil
+}
+
+// current returns the current context, or the first one when the current context is not set
+func (s kubeconfigSummary) current() (contextSummary, bool) {
+	for _, context := range s.Contexts {
+		if context.Name == s.CurrentContext {
+			return context, true
+		}
+	}
+	if len(s.Contexts) > 0 {
+		return s.Contexts[0], true
+	}
+	return contextSummary{}, false
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	infisical "github.com/infisical/go-sdk"
 	"github.com/ktr0731/go-fuzzyfinder"
@@ -43,7 +46,7 @@ func validateKubeconfig(config *api.Config) error {
 	clusterName := context.Cluster
 	cluster, exists := config.Clusters[clusterName]
 	if !exists {
-		return fmt.Errorf("cluster '%s' referenced by context '%s' not found in clusters", 
+		return fmt.Errorf("cluster '%s' referenced by context '%s' not found in clusters",
 			clusterName, config.CurrentContext)
 	}
 
@@ -59,17 +62,15 @@ func validateKubeconfig(config *api.Config) error {
 
 	authInfo, exists := config.AuthInfos[context.AuthInfo]
 	if !exists {
-		return fmt.Errorf("user '%s' referenced by context '%s' not found in users", 
+		return fmt.Errorf("user '%s' referenced by context '%s' not found in users",
 			context.AuthInfo, config.CurrentContext)
 	}
 
-	// Check if at least one authentication method is specified
-	hasAuth := authInfo.Token != "" || 
-		authInfo.ClientCertificate != "" || 
+	// Check if at least one authentication method is specified. File references
+	// (client-certificate, client-key, tokenFile) do not count: they only exist on the uploader's machine.
+	hasAuth := authInfo.Token != "" ||
 		authInfo.ClientCertificateData != nil ||
-		authInfo.ClientKey != "" ||
 		authInfo.ClientKeyData != nil ||
-		authInfo.TokenFile != "" ||
 		authInfo.Exec != nil
 
 	if !hasAuth {
@@ -79,27 +80,45 @@ func validateKubeconfig(config *api.Config) error {
 	return nil
 }
 
-func handleStoreKubeconfig(client infisical.InfisicalClientInterface, projectID string, config appConfig) {
-	// Read kubeconfig from stdin
-	scanner := bufio.NewScanner(os.Stdin)
-	var kubeconfig string
-	for scanner.Scan() {
-		kubeconfig += scanner.Text() + "\n"
+// readKubeconfigInput reads the kubeconfig to store from the file given with -f, or from stdin
+func readKubeconfigInput(config appConfig) string {
+	input := os.Stdin
+	source := "stdin"
+	if config.file != "" {
+		file, err := os.Open(config.file)
+		if err != nil {
+			if config.verbose {
+				fmt.Printf("Error opening %s: %v\n", config.file, err)
+			} else {
+				fmt.Printf("Error opening %s\n", config.file)
+			}
+			exit(1)
+		}
+		defer file.Close()
+		input = file
+		source = config.file
+	} else if stat, _ := os.Stdin.Stat(); (stat.Mode() & os.ModeCharDevice) != 0 {
+		fmt.Println("Error: No kubeconfig provided, pipe one into stdin or use -f")
+		exit(1)
 	}
 
-	if err := scanner.Err(); err != nil {
+	data, err := io.ReadAll(input)
+	if err != nil {
 		if config.verbose {
-			fmt.Printf("Error reading from stdin: %v\n", err)
+			fmt.Printf("Error reading from %s: %v\n", source, err)
 		} else {
-			fmt.Println("Error reading from stdin")
+			fmt.Printf("Error reading from %s\n", source)
 		}
-		os.Exit(1)
+		exit(1)
 	}
+	return string(data)
+}
 
+func handleStoreKubeconfig(client infisical.InfisicalClientInterface, projectID string, kubeconfig string, config appConfig) {
 	// Check if input is empty
 	if strings.TrimSpace(kubeconfig) == "" {
 		fmt.Println("Error: Empty kubeconfig received")
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Parse kubeconfig
@@ -110,9 +129,39 @@ func handleStoreKubeconfig(client infisical.InfisicalClientInterface, projectID
 		} else {
 			fmt.Println("Error: Invalid kubeconfig format")
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	var entries []kubeconfigEntry
+	if config.split {
+		// Store every selected context as its own secret
+		entries = splitKubeconfig(kubeCfg, config)
+	} else {
+		entries = []kubeconfigEntry{singleKubeconfigEntry(kubeCfg, config)}
+	}
+
+	storeKubeconfigEntries(client, projectID, entries, config)
+}
+
+// singleKubeconfigEntry prepares kubeCfg to be stored as one secret named after its current cluster,
+// keeping only the current context unless --no-minify is set
+func singleKubeconfigEntry(kubeCfg *api.Config, config appConfig) kubeconfigEntry {
+	// Keep only the current context with its cluster and user
+	if !config.noMinify {
+		if err := api.MinifyConfig(kubeCfg); err != nil {
+			if config.verbose {
+				fmt.Printf("Error minifying kubeconfig: %v\n", err)
+			} else {
+				fmt.Println("Error minifying kubeconfig")
+			}
+			exit(1)
+		}
 	}
 
+	// Flatten only what is stored, so that files of the other contexts need not exist,
+	// and before validating, since credentials referenced as files only count once embedded
+	flattenStoredKubeconfig(kubeCfg, config)
+
 	// Validate kubeconfig structure
 	if err := validateKubeconfig(kubeCfg); err != nil {
 		if config.verbose {
@@ -120,19 +169,54 @@ func handleStoreKubeconfig(client infisical.InfisicalClientInterface, projectID
 		} else {
 			fmt.Println("Error: Invalid kubeconfig")
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	data, err := clientcmd.Write(*kubeCfg)
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error serializing kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error serializing kubeconfig")
+		}
+		exit(1)
 	}
 
 	// Get cluster details
-	currentContext := kubeCfg.CurrentContext
-	clusterName := kubeCfg.Contexts[currentContext].Cluster
-	serverAddress := kubeCfg.Clusters[clusterName].Server
+	clusterName := kubeCfg.Contexts[kubeCfg.CurrentContext].Cluster
+	return kubeconfigEntry{
+		key:    clusterName,
+		value:  string(data),
+		server: kubeCfg.Clusters[clusterName].Server,
+	}
+}
+
+// kubeconfigEntry is a kubeconfig ready to be stored under a secret key
+type kubeconfigEntry struct {
+	key    string
+	value  string
+	server string
+}
 
-	// First, check if the secret already exists
+// storeKubeconfigEntries creates or updates one secret per entry, exiting with an error if any of them failed
+func storeKubeconfigEntries(client infisical.InfisicalClientInterface, projectID string, entries []kubeconfigEntry, config appConfig) {
+	// Check every entry against the validation policy before storing any of them
+	compliant := true
+	for _, entry := range entries {
+		if !checkLintPolicy(entry.key, entry.value, config) {
+			compliant = false
+		}
+	}
+	if !compliant {
+		fmt.Println("Error: Kubeconfig violates the validation policy, refusing to store it")
+		exit(1)
+	}
+
+	// First, check which secrets already exist
 	result, err := client.Secrets().ListSecrets(infisical.ListSecretsOptions{
 		ProjectID:          projectID,
-		Environment:        "config",
-		SecretPath:         "/",
+		Environment:        config.environment,
+		SecretPath:         config.secretPath,
 		AttachToProcessEnv: false,
 	})
 	if err != nil {
@@ -141,151 +225,268 @@ func handleStoreKubeconfig(client infisical.InfisicalClientInterface, projectID
 		} else {
 			fmt.Println("Failed to check existing secrets")
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	existingKeys := make(map[string]bool, len(result.Secrets))
+	for _, secret := range result.Secrets {
+		existingKeys[secret.SecretKey] = true
 	}
-	secrets := result.Secrets
 
-	var existingSecret *infisical.Secret
-	for _, secret := range secrets {
-		if secret.SecretKey == clusterName {
-			existingSecret = &secret
-			break
+	failed := false
+	for _, entry := range entries {
+		if existingKeys[entry.key] {
+			// Update existing secret
+			_, err = client.Secrets().Update(infisical.UpdateSecretOptions{
+				ProjectID:      projectID,
+				Environment:    config.environment,
+				SecretPath:     config.secretPath,
+				SecretKey:      entry.key,
+				NewSecretValue: entry.value,
+			})
+			if err != nil {
+				if config.verbose {
+					fmt.Printf("Failed to update secret %s: %v\n", entry.key, err)
+				} else {
+					fmt.Printf("Failed to update secret %s\n", entry.key)
+				}
+				failed = true
+				continue
+			}
+			fmt.Printf("Successfully updated kubeconfig for cluster: %s\n", entry.key)
+		} else {
+			// Create new secret
+			_, err = client.Secrets().Create(infisical.CreateSecretOptions{
+				ProjectID:     projectID,
+				Environment:   config.environment,
+				SecretPath:    config.secretPath,
+				SecretKey:     entry.key,
+				SecretValue:   entry.value,
+				SecretComment: fmt.Sprintf("Cluster: %s\nServer: %s", entry.key, entry.server),
+			})
+			if err != nil {
+				if config.verbose {
+					fmt.Printf("Failed to store secret %s: %v\n", entry.key, err)
+				} else {
+					fmt.Printf("Failed to store secret %s\n", entry.key)
+				}
+				failed = true
+				continue
+			}
+			fmt.Printf("Successfully stored kubeconfig for cluster: %s\n", entry.key)
 		}
 	}
 
-	if existingSecret != nil {
-		// Update existing secret
-		_, err = client.Secrets().Update(infisical.UpdateSecretOptions{
-			ProjectID:      projectID,
-			Environment:    "config",
-			SecretKey:      clusterName,
-			NewSecretValue: kubeconfig,
+	if failed {
+		exit(1)
+	}
+}
+
+// secretName returns the name of a stored kubeconfig, prefixed with its folder relative to basePath
+func secretName(secret infisical.Secret, basePath string) string {
+	folder := basePath
+	if secret.SecretPath != "" {
+		folder = normalizeSecretPath(secret.SecretPath)
+	}
+
+	relative := strings.TrimPrefix(strings.TrimPrefix(folder, basePath), "/")
+	return path.Join(relative, secret.SecretKey)
+}
+
+// retrieveSecrets lists the secrets of the configured Infisical location. When the cache is enabled,
+// a successful listing refreshes it and a failed one, or a nil client, falls back to it.
+// The returned time is when the cached secrets were fetched, and is zero for live results.
+func retrieveSecrets(client infisical.InfisicalClientInterface, projectID string, config appConfig) ([]infisical.Secret, time.Time) {
+	if client != nil {
+		// Get all secrets, including the ones stored in sub-folders
+		result, err := client.Secrets().ListSecrets(infisical.ListSecretsOptions{
+			ProjectID:            projectID,
+			Environment:          config.environment,
+			SecretPath:           config.secretPath,
+			Recursive:            config.recursive,
+			SkipUniqueValidation: true,
+			AttachToProcessEnv:   false,
 		})
-		if err != nil {
-			if config.verbose {
-				fmt.Printf("Failed to update secret: %v\n", err)
-			} else {
-				fmt.Println("Failed to update secret")
+		if err == nil {
+			if config.cache {
+				if err := saveSecretCache(config, result.Secrets); err != nil {
+					if config.verbose {
+						fmt.Fprintf(os.Stderr, "Warning: Failed to update cache: %v\n", err)
+					} else {
+						fmt.Fprintln(os.Stderr, "Warning: Failed to update cache")
+					}
+				}
 			}
-			os.Exit(1)
+			return result.Secrets, time.Time{}
 		}
-		fmt.Printf("Successfully updated kubeconfig for cluster: %s\n", clusterName)
-	} else {
-		// Create new secret
-		_, err = client.Secrets().Create(infisical.CreateSecretOptions{
-			ProjectID:     projectID,
-			Environment:   "config",
-			SecretKey:     clusterName,
-			SecretValue:   kubeconfig,
-			SecretComment: fmt.Sprintf("Cluster: %s\nServer: %s", clusterName, serverAddress),
-		})
-		if err != nil {
+
+		if !config.cache {
 			if config.verbose {
-				fmt.Printf("Failed to store secret: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Failed to retrieve secrets: %v\n", err)
 			} else {
-				fmt.Println("Failed to store secret")
+				fmt.Fprintln(os.Stderr, "Failed to retrieve secrets")
 			}
-			os.Exit(1)
+			exit(1)
+		}
+
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to retrieve secrets: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning: Failed to retrieve secrets")
 		}
-		fmt.Printf("Successfully stored kubeconfig for cluster: %s\n", clusterName)
 	}
-}
 
-func handleListSecrets(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
-	// Get all secrets
-	result, err := client.Secrets().ListSecrets(infisical.ListSecretsOptions{
-		ProjectID:          projectID,
-		Environment:        "config",
-		SecretPath:         "/",
-		AttachToProcessEnv: false,
-	})
+	cache, err := loadSecretCache(config)
 	if err != nil {
 		if config.verbose {
-			fmt.Printf("Failed to retrieve secrets: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Failed to load cached kubeconfigs: %v\n", err)
 		} else {
-			fmt.Println("Failed to retrieve secrets")
+			fmt.Fprintln(os.Stderr, "Failed to load cached kubeconfigs")
 		}
-		os.Exit(1)
+		exit(1)
 	}
-	secrets := result.Secrets
 
-	if len(secrets) == 0 {
-		fmt.Println("No kubeconfigs found")
-		os.Exit(0)
+	fmt.Fprintf(os.Stderr, "Using cached kubeconfigs, stale since %s\n", cache.FetchedAt.Format(time.DateTime))
+	return cache.Secrets, cache.FetchedAt
+}
+
+// fetchKubeconfigs retrieves the stored kubeconfigs whose name contains filter, exiting when there are none.
+// The returned time is when the kubeconfigs were cached, and is zero when they were fetched from Infisical.
+func fetchKubeconfigs(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) ([]infisical.Secret, time.Time) {
+	secrets, cachedAt := retrieveSecrets(client, projectID, config)
+	notFound := "No kubeconfigs found"
+
+	// Sort by folder then key so that folders are grouped together
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secretName(secrets[i], config.secretPath) < secretName(secrets[j], config.secretPath)
+	})
+
+	// Keep only the secrets below the folder prefix if one is provided
+	if config.folder != "" && len(secrets) > 0 {
+		prefix := strings.Trim(config.folder, "/") + "/"
+		filteredSecrets := make([]infisical.Secret, 0)
+		for _, secret := range secrets {
+			if strings.HasPrefix(secretName(secret, config.secretPath), prefix) {
+				filteredSecrets = append(filteredSecrets, secret)
+			}
+		}
+		secrets = filteredSecrets
+		notFound = fmt.Sprintf("No kubeconfigs found in folder: %s", config.folder)
 	}
 
 	// Filter secrets if a filter is provided
-	if filter != "" {
+	if filter != "" && len(secrets) > 0 {
 		filteredSecrets := make([]infisical.Secret, 0)
 		for _, secret := range secrets {
-			if strings.Contains(strings.ToLower(secret.SecretKey), filter) {
+			if strings.Contains(strings.ToLower(secretName(secret, config.secretPath)), filter) {
 				filteredSecrets = append(filteredSecrets, secret)
 			}
 		}
 		secrets = filteredSecrets
+		notFound = fmt.Sprintf("No kubeconfigs found matching filter: %s", filter)
+	}
 
-		if len(secrets) == 0 {
-			fmt.Printf("No kubeconfigs found matching filter: %s\n", filter)
-			os.Exit(0)
+	if len(secrets) == 0 {
+		fmt.Fprintln(os.Stderr, notFound)
+		// Machine-readable output still needs a document, an empty list
+		if config.format != formatJSON && config.format != formatYAML {
+			exit(0)
 		}
 	}
 
-	var selectedSecret infisical.Secret
+	return secrets, cachedAt
+}
+
+// selectKubeconfig lets the user pick one of the stored kubeconfigs matching filter, or the one named
+// by --exact. It returns false when the selection was cancelled.
+func selectKubeconfig(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) (infisical.Secret, bool) {
+	// An exact name never opens the fuzzy finder
+	if config.exact != "" {
+		return findKubeconfig(client, projectID, config.exact, config), true
+	}
+
+	secrets, cachedAt := fetchKubeconfigs(client, projectID, filter, config)
+
 	if len(secrets) == 1 {
 		// If there's only one result, use it directly
-		selectedSecret = secrets[0]
-		fmt.Printf("Using only available kubeconfig: %s\n", selectedSecret.SecretKey)
-	} else {
-		// Use fuzzy finder to select a kubeconfig
-		idx, err := fuzzyfinder.Find(
-			secrets,
-			func(i int) string {
-				return secrets[i].SecretKey
-			},
-			fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
-				if i == -1 {
-					return ""
-				}
+		fmt.Fprintf(os.Stderr, "Using only available kubeconfig: %s\n", secretName(secrets[0], config.secretPath))
+		return secrets[0], true
+	}
 
-				// Parse the kubeconfig to get cluster details
-				kubeCfg, err := clientcmd.Load([]byte(secrets[i].SecretValue))
-				if err != nil {
-					return fmt.Sprintf("Error parsing kubeconfig: %v", err)
-				}
+	// Use fuzzy finder to select a kubeconfig
+	previewer := newKubeconfigPreviewer(client, projectID, cachedAt, config)
+	idx, err := fuzzyfinder.Find(
+		secrets,
+		func(i int) string {
+			return secretName(secrets[i], config.secretPath)
+		},
+		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
+			if i == -1 {
+				return ""
+			}
+			return previewer.render(secrets[i])
+		}),
+	)
 
-				// Get cluster details
-				clusterName := secrets[i].SecretKey
-				cluster := kubeCfg.Clusters[clusterName]
+	if err != nil {
+		if err == fuzzyfinder.ErrAbort {
+			fmt.Fprintln(os.Stderr, "Selection cancelled")
+			return infisical.Secret{}, false
+		}
+		if config.verbose {
+			fmt.Printf("Error during selection: %v\n", err)
+		} else {
+			fmt.Println("Error during selection")
+		}
+		exit(1)
+	}
 
-				server := ""
-				if cluster != nil {
-					server = cluster.Server
-				}
+	return secrets[idx], true
+}
 
-				return fmt.Sprintf("Cluster: %s\nServer: %s\nComment: %s",
-					clusterName,
-					server,
-					secrets[i].SecretComment)
-			}),
-		)
+func handleUseKubeconfig(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
+	selectedSecret, ok := selectKubeconfig(client, projectID, filter, config)
+	if !ok {
+		return
+	}
 
-		if err != nil {
-			if err == fuzzyfinder.ErrAbort {
-				fmt.Println("Selection cancelled")
-				return
-			}
+	guardKubeconfig(selectedSecret, config)
+	if config.verify && !verifyKubeconfig(selectedSecret, config) {
+		exit(1)
+	}
+
+	writeSelectedKubeconfig(selectedSecret, config)
+}
+
+// writeSelectedKubeconfig sends a kubeconfig where the flags ask for: stdout, a file, a temporary shell,
+// or ~/.kube/config by default
+func writeSelectedKubeconfig(selectedSecret infisical.Secret, config appConfig) {
+	if config.stdout {
+		// Print only the kubeconfig so that it can be piped into other tools
+		fmt.Print(selectedSecret.SecretValue)
+		return
+	}
+
+	if config.outputPath != "" {
+		if err := writeKubeconfigOutput(config.outputPath, []byte(selectedSecret.SecretValue)); err != nil {
 			if config.verbose {
-				fmt.Printf("Error during selection: %v\n", err)
+				fmt.Printf("Error writing kubeconfig: %v\n", err)
 			} else {
-				fmt.Println("Error during selection")
+				fmt.Println("Error writing kubeconfig")
 			}
-			os.Exit(1)
+			exit(1)
 		}
 
-		selectedSecret = secrets[idx]
+		fmt.Printf("Successfully wrote kubeconfig for cluster %s to %s\n", secretName(selectedSecret, config.secretPath), config.outputPath)
+		return
 	}
 
 	if config.temp {
+		if !confirmNestedShell() {
+			fmt.Println("Shell cancelled")
+			return
+		}
+
 		// Create temporary kubeconfig file
 		tmpPath, err := createTempKubeconfig([]byte(selectedSecret.SecretValue))
 		if err != nil {
@@ -294,21 +495,21 @@ func handleListSecrets(client infisical.InfisicalClientInterface, projectID stri
 			} else {
 				fmt.Println("Error creating temporary kubeconfig")
 			}
-			os.Exit(1)
+			exit(1)
 		}
-		
+
 		// Ensure cleanup of temporary file
-		defer os.Remove(tmpPath)
+		defer removeTempKubeconfig(tmpPath)
 
 		// Launch shell with temporary kubeconfig
-		err = launchShellWithKubeconfig(tmpPath, selectedSecret.SecretKey, config)
+		err = launchShellWithKubeconfig(tmpPath, secretName(selectedSecret, config.secretPath), config)
 		if err != nil {
 			if config.verbose {
 				fmt.Printf("Error launching shell: %v\n", err)
 			} else {
 				fmt.Println("Error launching shell")
 			}
-			os.Exit(1)
+			exit(1)
 		}
 		return
 	}
@@ -321,7 +522,7 @@ func handleListSecrets(client infisical.InfisicalClientInterface, projectID stri
 		} else {
 			fmt.Println("Error getting home directory")
 		}
-		os.Exit(1)
+		exit(1)
 	}
 
 	// Create .kube directory if it doesn't exist
@@ -332,19 +533,46 @@ func handleListSecrets(client infisical.InfisicalClientInterface, projectID stri
 		} else {
 			fmt.Println("Error creating .kube directory")
 		}
-		os.Exit(1)
+		exit(1)
 	}
 
-	// Write kubeconfig to file
 	kubeconfigPath := filepath.Join(kubeDir, "config")
-	if err := os.WriteFile(kubeconfigPath, []byte(selectedSecret.SecretValue), 0600); err != nil {
+
+	// Keep a copy of the current kubeconfig before touching it
+	if _, err := backupKubeconfig(kubeconfigPath, config.backups); err != nil {
+		if config.verbose {
+			fmt.Printf("Error backing up kubeconfig: %v\n", err)
+		} else {
+			fmt.Println("Error backing up kubeconfig")
+		}
+		exit(1)
+	}
+
+	if config.overwrite {
+		// Replace the whole kubeconfig with the selected one
+		if err := writeFileAtomic(kubeconfigPath, []byte(selectedSecret.SecretValue), 0600); err != nil {
+			if config.verbose {
+				fmt.Printf("Error writing kubeconfig: %v\n", err)
+			} else {
+				fmt.Println("Error writing kubeconfig")
+			}
+			exit(1)
+		}
+
+		fmt.Printf("Successfully configured kubeconfig for cluster: %s\n", secretName(selectedSecret, config.secretPath))
+		return
+	}
+
+	// Merge the selected kubeconfig into the existing one
+	currentContext, err := mergeKubeconfig(kubeconfigPath, []byte(selectedSecret.SecretValue), selectedSecret.SecretKey)
+	if err != nil {
 		if config.verbose {
-			fmt.Printf("Error writing kubeconfig: %v\n", err)
+			fmt.Printf("Error merging kubeconfig: %v\n", err)
 		} else {
-			fmt.Println("Error writing kubeconfig")
+			fmt.Println("Error merging kubeconfig")
 		}
-		os.Exit(1)
+		exit(1)
 	}
 
-	fmt.Printf("Successfully configured kubeconfig for cluster: %s\n", selectedSecret.SecretKey)
+	fmt.Printf("Successfully merged kubeconfig for cluster: %s (context: %s)\n", secretName(selectedSecret, config.secretPath), currentContext)
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatName  = "name"
+)
+
+var listFormats = []string{formatTable, formatJSON, formatYAML, formatName}
+
+// listEntry is a stored kubeconfig as printed by ikube ls, without any secret material
+type listEntry struct {
+	Name         string     `json:"name"`
+	Server       string     `json:"server,omitempty"`
+	Contexts     []string   `json:"contexts"`
+	AuthType     string     `json:"authType,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// secretTimestampKey identifies a secret across folders
+func secretTimestampKey(secretPath string, key string) string {
+	return path.Join(normalizeSecretPath(secretPath), key)
+}
+
+// fetchSecretTimestamps returns the last modification time of the stored kubeconfigs, keyed by secretTimestampKey.
+// The SDK does not expose it, so the secrets are listed again through the API without their values.
+func fetchSecretTimestamps(client infisical.InfisicalClientInterface, projectID string, config appConfig) (map[string]time.Time, error) {
+	query := url.Values{}
+	query.Set("workspaceId", projectID)
+	query.Set("environment", config.environment)
+	query.Set("secretPath", config.secretPath)
+	query.Set("recursive", fmt.Sprint(config.recursive))
+	query.Set("viewSecretValue", "false")
+	query.Set("expandSecretReferences", "false")
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/api/v3/secrets/raw?%s", config.infisicalServer, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+client.Auth().GetAccessToken())
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Secrets []struct {
+			SecretKey  string    `json:"secretKey"`
+			SecretPath string    `json:"secretPath"`
+			UpdatedAt  time.Time `json:"updatedAt"`
+		} `json:"secrets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode secrets: %v", err)
+	}
+
+	timestamps := make(map[string]time.Time, len(body.Secrets))
+	for _, secret := range body.Secrets {
+		if !secret.UpdatedAt.IsZero() {
+			timestamps[secretTimestampKey(secret.SecretPath, secret.SecretKey)] = secret.UpdatedAt
+		}
+	}
+	return timestamps, nil
+}
+
+// newListEntry describes a stored kubeconfig, reporting parse failures in the entry instead of failing
+func newListEntry(secret infisical.Secret, timestamps map[string]time.Time, config appConfig) listEntry {
+	entry := listEntry{
+		Name:     secretName(secret, config.secretPath),
+		Contexts: []string{},
+		Comment:  secret.SecretComment,
+	}
+	if modified, ok := timestamps[secretTimestampKey(secret.SecretPath, secret.SecretKey)]; ok {
+		entry.LastModified = &modified
+	}
+
+	summary, err := summarizeKubeconfig(secret.SecretValue)
+	if err != nil {
+		entry.Error = fmt.Sprintf("invalid kubeconfig: %v", err)
+		return entry
+	}
+	for _, context := range summary.Contexts {
+		entry.Contexts = append(entry.Contexts, context.Name)
+	}
+	if current, ok := summary.current(); ok {
+		entry.Server = current.Server
+		entry.AuthType = current.AuthType
+	}
+	return entry
+}
+
+func printListTable(entries []listEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSERVER\tCONTEXTS\tAUTH\tLAST MODIFIED\tCOMMENT")
+	for _, entry := range entries {
+		modified := "-"
+		if entry.LastModified != nil {
+			modified = entry.LastModified.Local().Format(time.DateTime)
+		}
+		auth := entry.AuthType
+		if entry.Error != "" {
+			auth = "invalid"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Name,
+			entry.Server,
+			strings.Join(entry.Contexts, ","),
+			auth,
+			modified,
+			strings.ReplaceAll(entry.Comment, "\n", " "))
+	}
+	w.Flush()
+}
+
+func handleListKubeconfigs(client infisical.InfisicalClientInterface, projectID string, filter string, config appConfig) {
+	secrets, _ := fetchKubeconfigs(client, projectID, filter, config)
+
+	if config.format == formatName {
+		for _, secret := range secrets {
+			fmt.Println(secretName(secret, config.secretPath))
+		}
+		return
+	}
+
+	// Modification times are a nice to have, they are not available from the offline cache
+	var timestamps map[string]time.Time
+	if client != nil {
+		var err error
+		timestamps, err = fetchSecretTimestamps(client, projectID, config)
+		if err != nil && config.verbose {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to retrieve modification times: %v\n", err)
+		}
+	}
+
+	entries := make([]listEntry, 0, len(secrets))
+	for _, secret := range secrets {
+		entries = append(entries, newListEntry(secret, timestamps, config))
+	}
+
+	switch config.format {
+	case formatJSON:
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+	case formatYAML:
+		data, err := yaml.Marshal(entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding YAML: %v\n", err)
+			exit(1)
+		}
+		fmt.Print(string(data))
+	default:
+		printListTable(entries)
+	}
+}
@@ -5,94 +5,581 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
+	"slices"
 	"strings"
-	"syscall"
+
+	infisical "github.com/infisical/go-sdk"
 )
 
 var version = "dev"
 
-func parseFlags() (string, appConfig) {
-	var config appConfig
-	flag.CommandLine.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  ikube [flags] [filter]\n\n")
-		flag.VisitAll(func(f *flag.Flag) {
+type command struct {
+	name    string
+	aliases []string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string)
+}
+
+func commands() []command {
+	return []command{
+		{name: "use", usage: "use [flags] [filter]", summary: "select a kubeconfig and merge it into ~/.kube/config", run: runUse},
+		{name: "add", usage: "add [flags]", summary: "store a kubeconfig read from stdin or a file", run: runAdd},
+		{name: "rm", aliases: []string{"delete"}, usage: "rm [flags] [filter]", summary: "delete kubeconfig(s)", run: runRm},
+		{name: "ls", aliases: []string{"list"}, usage: "ls [flags] [filter]", summary: "list stored kubeconfigs", run: runLs},
+		{name: "shell", usage: "shell [flags] [filter]", summary: "load a kubeconfig in a temporary shell", run: runShell},
+		{name: "get", usage: "get [flags] NAME", summary: "print or write the kubeconfig named NAME, without interaction", run: runGet},
+		{name: "exec", usage: "exec [flags] [CLUSTER...] -- COMMAND [ARGS...]", summary: "run a command with the kubeconfig of one or several clusters", run: runExec},
+		{name: "check", usage: "check [flags] [filter]", summary: "check that a cluster is reachable and its credentials work", run: runCheck},
+		{name: "audit", usage: "audit [flags] [filter]", summary: "report the health of every stored kubeconfig", run: runAudit},
+		{name: "lint", usage: "lint [flags] FILE...", summary: "check local kubeconfig files against the validation policy", run: runLint},
+		{name: "credential", usage: "credential [flags] NAME", summary: "act as a kubectl credential plugin serving the credentials of NAME", run: runCredential},
+		{name: "show", usage: "show [flags] [filter]", summary: "print a kubeconfig to stdout", run: runShow},
+		{name: "env", usage: "env [flags] [filter]", summary: "print the statements pointing KUBECONFIG at a kubeconfig for the current shell", run: runEnv},
+		{name: "init", usage: "init <bash|zsh|fish|powershell>", summary: "print the shell hook making \"use -l\" switch the current shell", run: runInit},
+		{name: "prompt-init", usage: "prompt-init <bash|zsh|fish>", summary: "print a snippet showing the cluster of ikube shells in the prompt", run: runPromptInit},
+		{name: "auth", usage: "auth <login|logout|list> [flags]", summary: "manage stored Infisical credentials", run: runAuth},
+		{name: "restore", usage: "restore [flags]", summary: "restore ~/.kube/config from a backup", run: runRestore},
+		{name: "version", usage: "version", summary: "display version", run: runVersion},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n  ikube [command] [flags] [filter]\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	for _, cmd := range commands() {
+		name := cmd.name
+		if len(cmd.aliases) > 0 {
+			name = fmt.Sprintf("%s (%s)", cmd.name, strings.Join(cmd.aliases, ", "))
+		}
+		fmt.Fprintf(out, "  %-16s%s\n", name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRunning ikube without a command is the same as \"ikube use\".\n")
+	fmt.Fprintf(out, "Run \"ikube <command> -h\" for the flags of a command.\n")
+}
+
+// newFlagSet creates the flag set of a command, with the flags shared by every command
+func newFlagSet(usage string, config *appConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("ikube", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  ikube %s\n\n", usage)
+		fs.VisitAll(func(f *flag.Flag) {
 			prefix := "-"
 			if len(f.Name) > 1 {
 				prefix = "--"
 			}
-			fmt.Fprintf(flag.CommandLine.Output(), "  %s%s\t%s\n", prefix, f.Name, f.Usage)
+			fmt.Fprintf(fs.Output(), "  %s%s\t%s\n", prefix, f.Name, f.Usage)
 		})
 	}
-	verbose := flag.Bool("v", false, "verbose mode")
-	temp := flag.Bool("l", false, "load kubeconfig in temporary shell")
-	delete := flag.Bool("d", false, "delete kubeconfig(s)")
-	showVersion := flag.Bool("version", false, "display version")
-	flag.Parse()
+	fs.BoolVar(&config.verbose, "v", false, "verbose mode")
+	return fs
+}
 
-	config.verbose = *verbose
-	config.temp = *temp
-	config.delete = *delete
+// parseFlags parses the arguments of a command and records which flags were explicitly set,
+// so that profile settings only apply to the flags left at their default
+func parseFlags(fs *flag.FlagSet, args []string, config *appConfig) {
+	fs.Parse(args)
 
-	// Check if version flag is set
-	if *showVersion {
-		fmt.Printf("ikube version %s\n", version)
-		os.Exit(0)
-	}
+	config.explicit = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		config.explicit[f.Name] = true
+	})
+}
 
-	// Get filter from remaining args
-	var filter string
-	if flag.NArg() > 0 {
-		filter = strings.ToLower(flag.Arg(0))
+// parseFilter returns the lowercased filter from the remaining arguments of a command
+func parseFilter(fs *flag.FlagSet) string {
+	if fs.NArg() > 0 {
+		return strings.ToLower(fs.Arg(0))
 	}
+	return ""
+}
 
-	return filter, config
+// addInfisicalFlags registers the flags selecting where kubeconfigs are stored in Infisical
+func addInfisicalFlags(fs *flag.FlagSet, config *appConfig) {
+	fs.StringVar(&config.profile, "profile", "", "profile of the configuration file to use")
+	fs.StringVar(&config.authMethod, "auth-method", "", fmt.Sprintf("Infisical auth method (%s)", strings.Join(authMethods, ", ")))
+	fs.StringVar(&config.environment, "env", "", "Infisical environment holding the kubeconfigs (default \"config\")")
+	fs.StringVar(&config.secretPath, "path", "", "Infisical folder path holding the kubeconfigs (default \"/\")")
 }
 
-func main() {
-	// Parse command line flags
-	filter, config := parseFlags()
+// addSelectionFlags registers the flags narrowing down which stored kubeconfigs are offered
+func addSelectionFlags(fs *flag.FlagSet, config *appConfig) {
+	fs.StringVar(&config.folder, "folder", "", "only include kubeconfigs below this folder (e.g. \"eu/prod\")")
+	fs.BoolVar(&config.recursive, "recursive", true, "include kubeconfigs stored in sub-folders")
+}
+
+// addExpiryFlags registers the flags controlling how expiring credentials are handled, for the commands using a kubeconfig
+func addExpiryFlags(fs *flag.FlagSet, config *appConfig) {
+	fs.DurationVar(&config.expiryWarning, "warn-within", defaultExpiryWarning, "warn about credentials expiring within this duration")
+	fs.BoolVar(&config.force, "force", false, "use the kubeconfig even if its credentials expired")
+}
+
+// addLintFlags registers the flag checking kubeconfigs against the validation policy before they are used
+func addLintFlags(fs *flag.FlagSet, config *appConfig) {
+	fs.BoolVar(&config.lint, "lint", false, "refuse kubeconfigs violating the validation policy of the configuration file")
+}
+
+// addCacheFlags registers the flags of the offline cache, for the commands that only read kubeconfigs
+func addCacheFlags(fs *flag.FlagSet, config *appConfig) {
+	config.cacheable = true
+	fs.BoolVar(&config.cache, "cache", false, "keep an encrypted local cache of kubeconfigs, used when Infisical is unreachable")
+	fs.BoolVar(&config.offline, "offline", false, "only use the local cache, without contacting Infisical")
+	fs.DurationVar(&config.cacheTTL, "cache-ttl", defaultCacheTTL, "maximum age of cached kubeconfigs (0 for no limit)")
+}
+
+// connect resolves the Infisical settings and authenticates, exiting on failure.
+// The returned client is nil when the kubeconfigs must be read from the offline cache.
+func connect(ctx context.Context, config *appConfig) (infisical.InfisicalClientInterface, string) {
+	loadSettings(config)
+	return connectResolved(ctx, *config)
+}
 
-	// Create a context that is cancelled on SIGINT/SIGTERM
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+// loadSettings resolves the Infisical settings of config, exiting on failure
+func loadSettings(config *appConfig) {
+	if err := resolveSettings(config); err != nil {
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error loading configuration")
+		}
+		exit(1)
+	}
+}
 
-	// Get Infisical server from environment variable
-	config.infisicalServer = os.Getenv("INFISICAL_SERVER")
-	if config.infisicalServer == "" {
-		config.infisicalServer = "app.infisical.com"
+// connectResolved authenticates with settings already resolved by loadSettings, like connect
+func connectResolved(ctx context.Context, config appConfig) (infisical.InfisicalClientInterface, string) {
+	if config.projectID == "" {
+		fmt.Fprintln(os.Stderr, "Error: Infisical project ID is not set, use INFISICAL_PROJECT_ID or the configuration file")
+		exit(1)
 	}
 
-	// Get project ID from environment variable
-	projectID := os.Getenv("INFISICAL_PROJECT_ID")
-	if projectID == "" {
-		fmt.Println("Error: INFISICAL_PROJECT_ID environment variable is not set")
-		os.Exit(1)
+	if config.offline {
+		return nil, config.projectID
 	}
 
 	// Authenticate with Infisical
 	client, err := authenticateInfisical(ctx, config)
 	if err != nil {
+		if config.cache {
+			if config.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to authenticate: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to authenticate on %s\n", config.infisicalServer)
+			}
+			return nil, config.projectID
+		}
+		if config.verbose {
+			fmt.Fprintf(os.Stderr, "Failed to authenticate: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Failed to authenticate on %s\n", config.infisicalServer)
+		}
+		exit(1)
+	}
+
+	return client, config.projectID
+}
+
+func runUse(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("use [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.exact, "exact", "", "select the kubeconfig with this exact name, without interaction")
+	fs.BoolVar(&config.temp, "l", false, "load kubeconfig in temporary shell")
+	fs.BoolVar(&config.overwrite, "overwrite", false, "overwrite ~/.kube/config instead of merging into it")
+	fs.StringVar(&config.outputPath, "output", "", "write the kubeconfig to this path instead of ~/.kube/config")
+	fs.BoolVar(&config.stdout, "stdout", false, "print the kubeconfig to stdout instead of writing ~/.kube/config")
+	fs.BoolVar(&config.verify, "verify", false, "check that the cluster is reachable and the credentials work before using the kubeconfig")
+	parseFlags(fs, args, &config)
+	config.profileOutput = true
+
+	if (config.temp && config.stdout) || (config.temp && config.outputPath != "") || (config.stdout && config.outputPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: -l, --stdout and --output cannot be used together")
+		exit(2)
+	}
+
+	client, projectID := connect(ctx, &config)
+	handleUseKubeconfig(client, projectID, parseFilter(fs), config)
+}
+
+func runAdd(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("add [flags]", &config)
+	addInfisicalFlags(fs, &config)
+	fs.StringVar(&config.file, "f", "", "read kubeconfig from file instead of stdin")
+	fs.BoolVar(&config.split, "split", false, "store each context as its own secret")
+	fs.StringVar(&config.contexts, "context", "", "comma-separated contexts to store with --split, instead of selecting them")
+	fs.BoolVar(&config.allContexts, "all", false, "store every context with --split, instead of selecting them")
+	fs.BoolVar(&config.noMinify, "no-minify", false, "keep every context instead of only the current one")
+	fs.BoolVar(&config.allowUnresolved, "allow-unresolved", false, "store the kubeconfig even if referenced files cannot be read")
+	parseFlags(fs, args, &config)
+
+	// Read the whole payload before authenticating, so that credential prompts never interleave with it
+	kubeconfig := readKubeconfigInput(config)
+
+	client, projectID := connect(ctx, &config)
+	handleStoreKubeconfig(client, projectID, kubeconfig, config)
+}
+
+func runRm(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("rm [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	parseFlags(fs, args, &config)
+
+	client, projectID := connect(ctx, &config)
+	handleDeleteKubeconfigs(client, projectID, parseFilter(fs), config)
+}
+
+func runLs(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("ls [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	fs.StringVar(&config.format, "o", formatTable, fmt.Sprintf("output format (%s)", strings.Join(listFormats, ", ")))
+	parseFlags(fs, args, &config)
+
+	if !slices.Contains(listFormats, config.format) {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported output format %s, use one of %s\n", config.format, strings.Join(listFormats, ", "))
+		exit(2)
+	}
+
+	client, projectID := connect(ctx, &config)
+	handleListKubeconfigs(client, projectID, parseFilter(fs), config)
+}
+
+func runShell(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("shell [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.exact, "exact", "", "select the kubeconfig with this exact name, without interaction")
+	fs.BoolVar(&config.verify, "verify", false, "check that the cluster is reachable and the credentials work before using the kubeconfig")
+	parseFlags(fs, args, &config)
+	config.temp = true
+
+	client, projectID := connect(ctx, &config)
+	handleUseKubeconfig(client, projectID, parseFilter(fs), config)
+}
+
+func runCheck(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("check [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	fs.StringVar(&config.exact, "exact", "", "select the kubeconfig with this exact name, without interaction")
+	fs.DurationVar(&config.checkTimeout, "timeout", defaultCheckTimeout, "maximum time to wait for the API server")
+	parseFlags(fs, args, &config)
+
+	client, projectID := connect(ctx, &config)
+	handleCheckKubeconfig(client, projectID, parseFilter(fs), config)
+}
+
+func runAudit(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("audit [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	fs.StringVar(&config.format, "o", formatTable, fmt.Sprintf("output format (%s)", strings.Join(auditFormats, ", ")))
+	fs.BoolVar(&config.probe, "probe", false, "also check that each cluster is reachable and its credentials work")
+	fs.IntVar(&config.concurrency, "concurrency", defaultAuditConcurrency, "number of kubeconfigs audited in parallel")
+	fs.DurationVar(&config.expiryWarning, "warn-within", defaultExpiryWarning, "warn about credentials expiring within this duration")
+	fs.DurationVar(&config.checkTimeout, "timeout", defaultCheckTimeout, "maximum time to wait for each API server with --probe")
+	parseFlags(fs, args, &config)
+
+	if !slices.Contains(auditFormats, config.format) {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported output format %s, use one of %s\n", config.format, strings.Join(auditFormats, ", "))
+		exit(2)
+	}
+
+	client, projectID := connect(ctx, &config)
+	handleAudit(client, projectID, parseFilter(fs), config)
+}
+
+func runLint(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("lint [flags] FILE...", &config)
+	fs.StringVar(&config.profile, "profile", "", "profile of the configuration file to use")
+	parseFlags(fs, args, &config)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exit(2)
+	}
+
+	// Linting only needs the policy of the configuration file, no need to authenticate
+	if err := resolveSettings(&config); err != nil {
 		if config.verbose {
-			fmt.Printf("Failed to authenticate: %v\n", err)
+			fmt.Printf("Error loading configuration: %v\n", err)
 		} else {
-			fmt.Printf("Failed to authenticate on %s\n", config.infisicalServer)
+			fmt.Println("Error loading configuration")
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	handleLint(fs.Args(), config)
+}
+
+func runCredential(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("credential [flags] NAME", &config)
+	addInfisicalFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.credentialUser, "user", "", "user of the kubeconfig to serve (default: user of the current context)")
+	fs.DurationVar(&config.credentialTTL, "ttl", defaultCredentialTTL, "how long credentials are cached in the keyring (0 to disable)")
+	fs.BoolVar(&config.install, "install", false, "write a kubeconfig getting its credentials from ikube instead of storing them")
+	fs.BoolVar(&config.overwrite, "overwrite", false, "overwrite ~/.kube/config instead of merging into it (with --install)")
+	fs.StringVar(&config.outputPath, "output", "", "write the kubeconfig to this path instead of ~/.kube/config (with --install)")
+	fs.BoolVar(&config.stdout, "stdout", false, "print the kubeconfig to stdout instead of writing ~/.kube/config (with --install)")
+	parseFlags(fs, args, &config)
+	config.recursive = true
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(2)
 	}
 
-	if config.delete {
-		handleDeleteKubeconfigs(client, projectID, filter, config)
+	if config.install {
+		client, projectID := connect(ctx, &config)
+		handleInstallCredential(client, projectID, fs.Arg(0), config)
 		return
 	}
 
-	// Check if we have stdin input
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
-		// Has stdin input - store new kubeconfig
-		handleStoreKubeconfig(client, projectID, config)
-	} else {
-		// No stdin input - list and select secrets
-		handleListSecrets(client, projectID, filter, config)
+	// kubectl reads the credentials from stdout, every message goes to stderr
+	handleCredential(ctx, os.Stdout, fs.Arg(0), config)
+}
+
+func runShow(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("show [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.exact, "exact", "", "select the kubeconfig with this exact name, without interaction")
+	parseFlags(fs, args, &config)
+	config.stdout = true
+
+	client, projectID := connect(ctx, &config)
+	handleUseKubeconfig(client, projectID, parseFilter(fs), config)
+}
+
+func runAuth(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage:\n  ikube auth <login|logout|list> [flags]\n")
+		exit(2)
+	}
+
+	var config appConfig
+	var all bool
+	fs := newFlagSet(fmt.Sprintf("auth %s [flags]", args[0]), &config)
+	fs.StringVar(&config.profile, "profile", "", "profile of the configuration file to use")
+	switch args[0] {
+	case "login", "list":
+	case "logout":
+		fs.BoolVar(&all, "all", false, "remove the credentials of every server and profile")
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown auth command: %s\n", args[0])
+		exit(2)
+	}
+	parseFlags(fs, args[1:], &config)
+
+	if err := resolveSettings(&config); err != nil {
+		if config.verbose {
+			fmt.Printf("Error loading configuration: %v\n", err)
+		} else {
+			fmt.Println("Error loading configuration")
+		}
+		exit(1)
+	}
+
+	switch args[0] {
+	case "login":
+		handleAuthLogin(ctx, config)
+	case "logout":
+		handleAuthLogout(config, all)
+	case "list":
+		handleAuthList(config)
+	}
+}
+
+func runGet(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("get [flags] NAME", &config)
+	addInfisicalFlags(fs, &config)
+	fs.BoolVar(&config.recursive, "recursive", true, "include kubeconfigs stored in sub-folders")
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.outputPath, "output", "", "write the kubeconfig to this path instead of stdout")
+	parseFlags(fs, args, &config)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(2)
+	}
+
+	client, projectID := connect(ctx, &config)
+	handleGetKubeconfig(client, projectID, fs.Arg(0), config)
+}
+
+func runExec(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("exec [flags] [CLUSTER...] -- COMMAND [ARGS...]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.BoolVar(&config.multi, "m", false, "select several clusters and run the command against them in parallel")
+
+	// Everything after "--" is the command, so that its flags are not parsed as ikube flags
+	separator := slices.Index(args, "--")
+	if separator < 0 {
+		fs.Usage()
+		exit(2)
+	}
+	command := args[separator+1:]
+	parseFlags(fs, args[:separator], &config)
+
+	if len(command) == 0 {
+		fs.Usage()
+		exit(2)
+	}
+
+	client, projectID := connect(ctx, &config)
+	handleExec(client, projectID, fs.Args(), command, config)
+}
+
+func runEnv(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("env [flags] [filter]", &config)
+	addInfisicalFlags(fs, &config)
+	addSelectionFlags(fs, &config)
+	addCacheFlags(fs, &config)
+	addExpiryFlags(fs, &config)
+	addLintFlags(fs, &config)
+	fs.StringVar(&config.exact, "exact", "", "select the kubeconfig with this exact name, without interaction")
+	fs.StringVar(&config.shell, "shell", defaultHookShell(), fmt.Sprintf("shell to print the statements for (%s)", strings.Join(hookShells, ", ")))
+	fs.IntVar(&config.sessionPID, "session-pid", os.Getppid(), "PID of the shell session owning the kubeconfig (default: parent process)")
+	fs.BoolVar(&config.verify, "verify", false, "check that the cluster is reachable and the credentials work before using the kubeconfig")
+	parseFlags(fs, args, &config)
+
+	client, projectID := connect(ctx, &config)
+	handleEnvKubeconfig(client, projectID, parseFilter(fs), config)
+}
+
+func runInit(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("init <bash|zsh|fish|powershell>", &config)
+	parseFlags(fs, args, &config)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(2)
+	}
+
+	handleInit(fs.Arg(0))
+}
+
+func runPromptInit(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("prompt-init <bash|zsh|fish>", &config)
+	parseFlags(fs, args, &config)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(2)
+	}
+
+	handlePromptInit(fs.Arg(0))
+}
+
+func runRestore(ctx context.Context, args []string) {
+	var config appConfig
+	fs := newFlagSet("restore [flags]", &config)
+	parseFlags(fs, args, &config)
+
+	// Restoring a backup only touches local files, no need to authenticate
+	fc, err := loadFileConfig()
+	if err == nil {
+		config.backups, err = backupRetention(fc)
+	}
+	if err != nil {
+		if config.verbose {
+			fmt.Printf("Error loading configuration: %v\n", err)
+		} else {
+			fmt.Println("Error loading configuration")
+		}
+		exit(1)
+	}
+	handleRestore(config)
+}
+
+func runVersion(ctx context.Context, args []string) {
+	fmt.Printf("ikube version %s\n", version)
+}
+
+func main() {
+	flag.CommandLine.Usage = printUsage
+
+	// Temporary kubeconfigs must not outlive ikube: remove them on signals and panics,
+	// and sweep the ones left behind by previous sessions that were killed
+	handleSignals()
+	defer func() {
+		if r := recover(); r != nil {
+			cleanupTempKubeconfigs()
+			panic(r)
+		}
+	}()
+	sweepStaleKubeconfigs()
+
+	ctx := context.Background()
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "--help", "-help", "help":
+			printUsage()
+			return
+		case "-version", "--version":
+			runVersion(ctx, nil)
+			return
+		}
+
+		if cmd, ok := findCommand(args[0]); ok {
+			cmd.run(ctx, args[1:])
+			return
+		}
 	}
+
+	// Without an explicit command, behave like "ikube use"
+	runUse(ctx, args)
 }
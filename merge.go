@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// loadKubeconfigFile loads the kubeconfig at path, returning an empty config if the file does not exist yet
+func loadKubeconfigFile(path string) (*api.Config, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return api.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// mergedName returns the name under which an incoming entry is stored in the existing kubeconfig.
+// Identical entries keep their name; a different entry with the same name is prefixed with the secret key.
+func mergedName[T any](existing map[string]*T, name string, value *T, prefix string, same func(a, b *T) bool) string {
+	current, exists := existing[name]
+	if !exists || same(current, value) {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", prefix, name)
+}
+
+func sameCluster(a, b *api.Cluster) bool {
+	x, y := *a, *b
+	x.LocationOfOrigin, y.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+func sameAuthInfo(a, b *api.AuthInfo) bool {
+	x, y := *a, *b
+	x.LocationOfOrigin, y.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+func sameContext(a, b *api.Context) bool {
+	x, y := *a, *b
+	x.LocationOfOrigin, y.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+// mergeKubeconfigs folds the clusters, users and contexts of incoming into existing and
+// makes the incoming current-context the active one. It returns the merged current-context name.
+func mergeKubeconfigs(existing, incoming *api.Config, secretKey string) string {
+	clusterNames := make(map[string]string, len(incoming.Clusters))
+	for name, cluster := range incoming.Clusters {
+		newName := mergedName(existing.Clusters, name, cluster, secretKey, sameCluster)
+		existing.Clusters[newName] = cluster
+		clusterNames[name] = newName
+	}
+
+	authInfoNames := make(map[string]string, len(incoming.AuthInfos))
+	for name, authInfo := range incoming.AuthInfos {
+		newName := mergedName(existing.AuthInfos, name, authInfo, secretKey, sameAuthInfo)
+		existing.AuthInfos[newName] = authInfo
+		authInfoNames[name] = newName
+	}
+
+	contextNames := make(map[string]string, len(incoming.Contexts))
+	for name, context := range incoming.Contexts {
+		// Point the context at the renamed cluster and user before comparing
+		if newName, ok := clusterNames[context.Cluster]; ok {
+			context.Cluster = newName
+		}
+		if newName, ok := authInfoNames[context.AuthInfo]; ok {
+			context.AuthInfo = newName
+		}
+		newName := mergedName(existing.Contexts, name, context, secretKey, sameContext)
+		existing.Contexts[newName] = context
+		contextNames[name] = newName
+	}
+
+	if newName, ok := contextNames[incoming.CurrentContext]; ok {
+		existing.CurrentContext = newName
+	}
+
+	return existing.CurrentContext
+}
+
+// mergeKubeconfig merges content into the kubeconfig file at path and writes it back atomically
+func mergeKubeconfig(path string, content []byte, secretKey string) (string, error) {
+	incoming, err := clientcmd.Load(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse selected kubeconfig: %v", err)
+	}
+
+	existing, err := loadKubeconfigFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load %s: %v", path, err)
+	}
+
+	currentContext := mergeKubeconfigs(existing, incoming, secretKey)
+
+	data, err := clientcmd.Write(*existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize merged kubeconfig: %v", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return "", err
+	}
+
+	return currentContext, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// so readers never observe a partially written kubeconfig. When path is a symlink, e.g. to a
+// dotfiles repository, its target is replaced and the symlink kept.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		path = resolved
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+
+	tmpfile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tmpPath := tmpfile.Name()
+
+	if _, err := tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temporary file: %v", err)
+	}
+
+	if err := tmpfile.Sync(); err != nil {
+		tmpfile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temporary file: %v", err)
+	}
+
+	if err := tmpfile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set permissions on temporary file: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+
+	return nil
+}
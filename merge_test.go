@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// testKubeconfig builds a kubeconfig whose context, cluster and user all share name
+func testKubeconfig(name, server, token string) *api.Config {
+	kubeCfg := api.NewConfig()
+	kubeCfg.Clusters[name] = &api.Cluster{Server: server}
+	kubeCfg.AuthInfos[name] = &api.AuthInfo{Token: token}
+	kubeCfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	kubeCfg.CurrentContext = name
+	return kubeCfg
+}
+
+func TestMergedName(t *testing.T) {
+	existing := map[string]*api.Cluster{
+		"prod": {Server: "https://prod:6443"},
+	}
+
+	tests := []struct {
+		name  string
+		entry string
+		value *api.Cluster
+		want  string
+	}{
+		{name: "new entry", entry: "dev", value: &api.Cluster{Server: "https://dev:6443"}, want: "dev"},
+		{name: "identical entry", entry: "prod", value: &api.Cluster{Server: "https://prod:6443"}, want: "prod"},
+		{name: "identical but for origin", entry: "prod", value: &api.Cluster{Server: "https://prod:6443", LocationOfOrigin: "/tmp/config"}, want: "prod"},
+		{name: "conflicting entry", entry: "prod", value: &api.Cluster{Server: "https://other:6443"}, want: "key-prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergedName(existing, tt.entry, tt.value, "key", sameCluster); got != tt.want {
+				t.Errorf("mergedName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeKubeconfigs(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *api.Config
+		incoming *api.Config
+		// want maps every expected context to its cluster and user
+		want        map[string]api.Context
+		wantCurrent string
+	}{
+		{
+			name:        "empty kubeconfig",
+			existing:    api.NewConfig(),
+			incoming:    testKubeconfig("prod", "https://prod:6443", "t1"),
+			want:        map[string]api.Context{"prod": {Cluster: "prod", AuthInfo: "prod"}},
+			wantCurrent: "prod",
+		},
+		{
+			name:        "distinct names",
+			existing:    testKubeconfig("dev", "https://dev:6443", "t0"),
+			incoming:    testKubeconfig("prod", "https://prod:6443", "t1"),
+			want:        map[string]api.Context{"dev": {Cluster: "dev", AuthInfo: "dev"}, "prod": {Cluster: "prod", AuthInfo: "prod"}},
+			wantCurrent: "prod",
+		},
+		{
+			name:        "identical kubeconfig",
+			existing:    testKubeconfig("prod", "https://prod:6443", "t1"),
+			incoming:    testKubeconfig("prod", "https://prod:6443", "t1"),
+			want:        map[string]api.Context{"prod": {Cluster: "prod", AuthInfo: "prod"}},
+			wantCurrent: "prod",
+		},
+		{
+			name:     "conflicting cluster",
+			existing: testKubeconfig("prod", "https://prod:6443", "t1"),
+			incoming: testKubeconfig("prod", "https://other:6443", "t1"),
+			want: map[string]api.Context{
+				"prod":     {Cluster: "prod", AuthInfo: "prod"},
+				"key-prod": {Cluster: "key-prod", AuthInfo: "prod"},
+			},
+			wantCurrent: "key-prod",
+		},
+		{
+			name:     "conflicting user",
+			existing: testKubeconfig("prod", "https://prod:6443", "t1"),
+			incoming: testKubeconfig("prod", "https://prod:6443", "t2"),
+			want: map[string]api.Context{
+				"prod":     {Cluster: "prod", AuthInfo: "prod"},
+				"key-prod": {Cluster: "prod", AuthInfo: "key-prod"},
+			},
+			wantCurrent: "key-prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := mergeKubeconfigs(tt.existing, tt.incoming, "key")
+			if current != tt.wantCurrent || tt.existing.CurrentContext != tt.wantCurrent {
+				t.Errorf("current-context = %q (returned %q), want %q", tt.existing.CurrentContext, current, tt.wantCurrent)
+			}
+
+			if len(tt.existing.Contexts) != len(tt.want) {
+				t.Errorf("got %d contexts, want %d", len(tt.existing.Contexts), len(tt.want))
+			}
+			for name, want := range tt.want {
+				context, exists := tt.existing.Contexts[name]
+				if !exists {
+					t.Errorf("context %q is missing", name)
+					continue
+				}
+				if context.Cluster != want.Cluster || context.AuthInfo != want.AuthInfo {
+					t.Errorf("context %q points at cluster %q and user %q, want %q and %q",
+						name, context.Cluster, context.AuthInfo, want.Cluster, want.AuthInfo)
+				}
+				if _, exists := tt.existing.Clusters[context.Cluster]; !exists {
+					t.Errorf("cluster %q of context %q is missing", context.Cluster, name)
+				}
+				if _, exists := tt.existing.AuthInfos[context.AuthInfo]; !exists {
+					t.Errorf("user %q of context %q is missing", context.AuthInfo, name)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicKeepsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles-config")
+	if err := os.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new"), 0600); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s is no longer a symlink", link)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new" {
+		t.Errorf("target content = %q, want %q", content, "new")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	infisical "github.com/infisical/go-sdk"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	severityError = "error"
+	severityWarn  = "warn"
+	severityOff   = "off"
+)
+
+// lintConfig holds the validation policy of the configuration file
+type lintConfig struct {
+	// Rules maps rule names to their severity: error, warn or off
+	Rules map[string]string `json:"rules,omitempty"`
+	// ExecAllowlist lists the credential plugins allowed by the exec-allowlist rule, e.g. "aws" or "kubelogin"
+	ExecAllowlist []string `json:"execAllowlist,omitempty"`
+	// OnUse also applies the policy when selecting a kubeconfig, not only when storing one
+	OnUse *bool `json:"onUse,omitempty"`
+}
+
+// lintPolicy is the resolved validation policy
+type lintPolicy struct {
+	severities    map[string]string
+	execAllowlist []string
+}
+
+// lintFinding is a rule violation found in a kubeconfig
+type lintFinding struct {
+	rule     string
+	severity string
+	message  string
+}
+
+// lintRule checks one aspect of a kubeconfig, returning a message per violation
+type lintRule struct {
+	name            string
+	defaultSeverity string
+	check           func(kubeCfg *api.Config, policy lintPolicy) []string
+}
+
+var lintRules = []lintRule{
+	{name: "insecure-skip-tls-verify", defaultSeverity: severityWarn, check: checkInsecureSkipTLSVerify},
+	{name: "http-server", defaultSeverity: severityWarn, check: checkHTTPServer},
+	{name: "static-token", defaultSeverity: severityOff, check: checkStaticToken},
+	{name: "basic-auth", defaultSeverity: severityWarn, check: checkBasicAuth},
+	{name: "exec-allowlist", defaultSeverity: severityOff, check: checkExecAllowlist},
+}
+
+func checkInsecureSkipTLSVerify(kubeCfg *api.Config, policy lintPolicy) []string {
+	var messages []string
+	for name, cluster := range kubeCfg.Clusters {
+		if cluster.InsecureSkipTLSVerify {
+			messages = append(messages, fmt.Sprintf("cluster '%s' disables TLS verification", name))
+		}
+	}
+	return messages
+}
+
+func checkHTTPServer(kubeCfg *api.Config, policy lintPolicy) []string {
+	var messages []string
+	for name, cluster := range kubeCfg.Clusters {
+		if u, err := url.Parse(cluster.Server); err == nil && u.Scheme == "http" {
+			messages = append(messages, fmt.Sprintf("cluster '%s' uses plain http server %s", name, cluster.Server))
+		}
+	}
+	return messages
+}
+
+func checkStaticToken(kubeCfg *api.Config, policy lintPolicy) []string {
+	var messages []string
+	for name, authInfo := range kubeCfg.AuthInfos {
+		if authInfo.Token != "" || authInfo.TokenFile != "" {
+			messages = append(messages, fmt.Sprintf("user '%s' authenticates with a static token", name))
+		}
+	}
+	return messages
+}
+
+func checkBasicAuth(kubeCfg *api.Config, policy lintPolicy) []string {
+	var messages []string
+	for name, authInfo := range kubeCfg.AuthInfos {
+		if authInfo.Username != "" || authInfo.Password != "" {
+			messages = append(messages, fmt.Sprintf("user '%s' authenticates with a username and password", name))
+		}
+	}
+	return messages
+}
+
+func checkExecAllowlist(kubeCfg *api.Config, policy lintPolicy) []string {
+	var messages []string
+	for name, authInfo := range kubeCfg.AuthInfos {
+		if authInfo.Exec == nil {
+			continue
+		}
+		if !slices.Contains(policy.execAllowlist, filepath.Base(authInfo.Exec.Command)) {
+			messages = append(messages, fmt.Sprintf("user '%s' runs credential plugin '%s', which is not allowed", name, authInfo.Exec.Command))
+		}
+	}
+	return messages
+}
+
+// resolveLintPolicy builds the policy from the default severities, then the top-level settings, then the profile
+func resolveLintPolicy(configs ...*lintConfig) (lintPolicy, bool, error) {
+	policy := lintPolicy{severities: make(map[string]string)}
+	for _, rule := range lintRules {
+		policy.severities[rule.name] = rule.defaultSeverity
+	}
+
+	onUse := false
+	for _, lc := range configs {
+		if lc == nil {
+			continue
+		}
+		for name, severity := range lc.Rules {
+			if _, exists := policy.severities[name]; !exists {
+				return policy, false, fmt.Errorf("unknown lint rule '%s'", name)
+			}
+			if severity != severityError && severity != severityWarn && severity != severityOff {
+				return policy, false, fmt.Errorf("invalid severity '%s' for lint rule '%s', expected %s, %s or %s", severity, name, severityError, severityWarn, severityOff)
+			}
+			policy.severities[name] = severity
+		}
+		if lc.ExecAllowlist != nil {
+			policy.execAllowlist = lc.ExecAllowlist
+		}
+		if lc.OnUse != nil {
+			onUse = *lc.OnUse
+		}
+	}
+
+	return policy, onUse, nil
+}
+
+// lintKubeconfig checks kubeCfg against the structural validation and the rules of policy, sorted by severity
+func lintKubeconfig(kubeCfg *api.Config, policy lintPolicy) []lintFinding {
+	var findings []lintFinding
+	if err := validateKubeconfig(kubeCfg); err != nil {
+		findings = append(findings, lintFinding{rule: "structure", severity: severityError, message: err.Error()})
+	}
+
+	for _, rule := range lintRules {
+		severity := policy.severities[rule.name]
+		if severity == "" || severity == severityOff {
+			continue
+		}
+		messages := rule.check(kubeCfg, policy)
+		slices.Sort(messages)
+		for _, message := range messages {
+			findings = append(findings, lintFinding{rule: rule.name, severity: severity, message: message})
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b lintFinding) int {
+		if a.severity == b.severity {
+			return 0
+		}
+		if a.severity == severityError {
+			return -1
+		}
+		return 1
+	})
+	return findings
+}
+
+// printLintFindings prints the findings of the kubeconfig named name to w and reports whether any is an error
+func printLintFindings(w io.Writer, name string, findings []lintFinding) bool {
+	failed := false
+	for _, finding := range findings {
+		fmt.Fprintf(w, "%s: %s [%s] %s\n", name, finding.severity, finding.rule, finding.message)
+		if finding.severity == severityError {
+			failed = true
+		}
+	}
+	return failed
+}
+
+// checkLintPolicy checks the kubeconfig named name against the policy, printing the findings on stderr.
+// It returns false when the kubeconfig breaks a rule whose severity is error.
+func checkLintPolicy(name string, value string, config appConfig) bool {
+	kubeCfg, err := clientcmd.Load([]byte(value))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error [parse] %s\n", name, strings.TrimSpace(err.Error()))
+		return false
+	}
+	return !printLintFindings(os.Stderr, name, lintKubeconfig(kubeCfg, config.lintPolicy))
+}
+
+// guardLint exits when the kubeconfig of secret violates the validation policy
+func guardLint(secret infisical.Secret, config appConfig) {
+	if !checkLintPolicy(secretName(secret, config.secretPath), secret.SecretValue, config) {
+		fmt.Fprintln(os.Stderr, "Error: Kubeconfig violates the validation policy, refusing to use it")
+		exit(1)
+	}
+}
+
+func handleLint(files []string, config appConfig) {
+	failed := false
+	for _, file := range files {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Printf("%s: error [read] %v\n", file, err)
+			failed = true
+			continue
+		}
+
+		kubeCfg, err := clientcmd.Load(data)
+		if err != nil {
+			fmt.Printf("%s: error [parse] %s\n", file, strings.TrimSpace(err.Error()))
+			failed = true
+			continue
+		}
+
+		// Local kubeconfigs commonly reference certificate files, which count as credentials once embedded
+		baseDir, err := os.Getwd()
+		if file != "-" {
+			baseDir, err = filepath.Abs(filepath.Dir(file))
+		}
+		var unresolved []error
+		if err == nil {
+			unresolved = flattenKubeconfig(kubeCfg, baseDir)
+		}
+
+		findings := lintKubeconfig(kubeCfg, config.lintPolicy)
+		for _, err := range unresolved {
+			findings = append(findings, lintFinding{rule: "unresolved", severity: severityWarn, message: err.Error()})
+		}
+		if len(findings) == 0 {
+			fmt.Printf("%s: ok\n", file)
+			continue
+		}
+		if printLintFindings(os.Stdout, file, findings) {
+			failed = true
+		}
+	}
+
+	if failed {
+		exit(1)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestResolveLintPolicy(t *testing.T) {
+	enabled := true
+
+	tests := []struct {
+		name          string
+		configs       []*lintConfig
+		wantSeverity  map[string]string
+		wantAllowlist []string
+		wantOnUse     bool
+		wantErr       bool
+	}{
+		{
+			name:         "defaults",
+			configs:      []*lintConfig{nil, nil},
+			wantSeverity: map[string]string{"insecure-skip-tls-verify": severityWarn, "static-token": severityOff, "exec-allowlist": severityOff},
+		},
+		{
+			name: "profile overrides top level",
+			configs: []*lintConfig{
+				{Rules: map[string]string{"http-server": severityError, "basic-auth": severityOff}, ExecAllowlist: []string{"aws"}},
+				{Rules: map[string]string{"http-server": severityWarn}, ExecAllowlist: []string{"kubelogin"}, OnUse: &enabled},
+			},
+			wantSeverity:  map[string]string{"http-server": severityWarn, "basic-auth": severityOff},
+			wantAllowlist: []string{"kubelogin"},
+			wantOnUse:     true,
+		},
+		{
+			name:          "allowlist inherited from top level",
+			configs:       []*lintConfig{{ExecAllowlist: []string{"aws"}}, {Rules: map[string]string{"exec-allowlist": severityError}}},
+			wantSeverity:  map[string]string{"exec-allowlist": severityError},
+			wantAllowlist: []string{"aws"},
+		},
+		{
+			name:    "unknown rule",
+			configs: []*lintConfig{{Rules: map[string]string{"no-such-rule": severityError}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid severity",
+			configs: []*lintConfig{{Rules: map[string]string{"http-server": "fatal"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, onUse, err := resolveLintPolicy(tt.configs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveLintPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for rule, want := range tt.wantSeverity {
+				if got := policy.severities[rule]; got != want {
+					t.Errorf("severity of %s = %q, want %q", rule, got, want)
+				}
+			}
+			if !slices.Equal(policy.execAllowlist, tt.wantAllowlist) {
+				t.Errorf("execAllowlist = %v, want %v", policy.execAllowlist, tt.wantAllowlist)
+			}
+			if onUse != tt.wantOnUse {
+				t.Errorf("onUse = %v, want %v", onUse, tt.wantOnUse)
+			}
+		})
+	}
+}
+
+func TestLintKubeconfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  map[string]string
+		allow  []string
+		modify func(kubeCfg *api.Config)
+		// want lists the findings as "severity/rule", in order
+		want []string
+	}{
+		{
+			name: "compliant kubeconfig",
+			want: nil,
+		},
+		{
+			name:   "default severities",
+			modify: func(kubeCfg *api.Config) { kubeCfg.Clusters["prod"].InsecureSkipTLSVerify = true },
+			want:   []string{"warn/insecure-skip-tls-verify"},
+		},
+		{
+			name:  "errors before warnings",
+			rules: map[string]string{"basic-auth": severityError},
+			modify: func(kubeCfg *api.Config) {
+				kubeCfg.Clusters["prod"].Server = "http://prod:6443"
+				kubeCfg.AuthInfos["prod"].Username = "admin"
+				kubeCfg.AuthInfos["prod"].Password = "secret"
+			},
+			want: []string{"error/basic-auth", "warn/http-server"},
+		},
+		{
+			name:   "disabled rule",
+			rules:  map[string]string{"insecure-skip-tls-verify": severityOff},
+			modify: func(kubeCfg *api.Config) { kubeCfg.Clusters["prod"].InsecureSkipTLSVerify = true },
+			want:   nil,
+		},
+		{
+			name:   "static token when enabled",
+			rules:  map[string]string{"static-token": severityWarn},
+			modify: func(kubeCfg *api.Config) { kubeCfg.AuthInfos["prod"].Token = "token" },
+			want:   []string{"warn/static-token"},
+		},
+		{
+			name:  "allowed credential plugin",
+			rules: map[string]string{"exec-allowlist": severityError},
+			allow: []string{"kubelogin"},
+			modify: func(kubeCfg *api.Config) {
+				kubeCfg.AuthInfos["prod"].Exec = &api.ExecConfig{Command: "/usr/local/bin/kubelogin"}
+			},
+			want: nil,
+		},
+		{
+			name:   "credential plugin missing from allowlist",
+			rules:  map[string]string{"exec-allowlist": severityError},
+			allow:  []string{"kubelogin"},
+			modify: func(kubeCfg *api.Config) { kubeCfg.AuthInfos["prod"].Exec = &api.ExecConfig{Command: "curl"} },
+			want:   []string{"error/exec-allowlist"},
+		},
+		{
+			name:   "empty allowlist refuses every plugin",
+			rules:  map[string]string{"exec-allowlist": severityWarn},
+			modify: func(kubeCfg *api.Config) { kubeCfg.AuthInfos["prod"].Exec = &api.ExecConfig{Command: "aws"} },
+			want:   []string{"warn/exec-allowlist"},
+		},
+		{
+			name:   "structure first",
+			modify: func(kubeCfg *api.Config) { kubeCfg.CurrentContext = "missing" },
+			want:   []string{"error/structure"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, _, err := resolveLintPolicy(&lintConfig{Rules: tt.rules, ExecAllowlist: tt.allow})
+			if err != nil {
+				t.Fatalf("resolveLintPolicy() error = %v", err)
+			}
+
+			// Client certificates pass the structural validation without triggering any rule
+			kubeCfg := testKubeconfig("prod", "https://prod:6443", "")
+			kubeCfg.AuthInfos["prod"] = &api.AuthInfo{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key")}
+			if tt.modify != nil {
+				tt.modify(kubeCfg)
+			}
+
+			var got []string
+			for _, finding := range lintKubeconfig(kubeCfg, policy) {
+				got = append(got, fmt.Sprintf("%s/%s", finding.severity, finding.rule))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lintKubeconfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	infisical "github.com/infisical/go-sdk"
+)
+
+// kubeconfigPreviewer renders the fuzzyfinder preview of stored kubeconfigs. The modification times are
+// loaded in the background, so that the picker opens without waiting for them.
+type kubeconfigPreviewer struct {
+	config   appConfig
+	cachedAt time.Time
+	checks   map[string]checkResult
+
+	mu         sync.Mutex
+	timestamps map[string]time.Time
+}
+
+// newKubeconfigPreviewer creates the previewer of kubeconfigs fetched from client, or from the offline cache
+// at cachedAt when it is not zero
+func newKubeconfigPreviewer(client infisical.InfisicalClientInterface, projectID string, cachedAt time.Time, config appConfig) *kubeconfigPreviewer {
+	p := &kubeconfigPreviewer{config: config, cachedAt: cachedAt, checks: loadCheckResults()}
+	if client != nil && cachedAt.IsZero() {
+		go func() {
+			timestamps, err := fetchSecretTimestamps(client, projectID, config)
+			if err != nil {
+				return
+			}
+			p.mu.Lock()
+			p.timestamps = timestamps
+			p.mu.Unlock()
+		}()
+	}
+	return p
+}
+
+func (p *kubeconfigPreviewer) updatedAt(secret infisical.Secret) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	updatedAt, ok := p.timestamps[secretTimestampKey(secret.SecretPath, secret.SecretKey)]
+	return updatedAt, ok
+}
+
+// render describes a stored kubeconfig. Credentials are never shown, only how each user authenticates.
+func (p *kubeconfigPreviewer) render(secret infisical.Secret) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Name: %s\n", secretName(secret, p.config.secretPath))
+	fmt.Fprintf(&b, "Folder: %s\n", secret.SecretPath)
+	fmt.Fprintf(&b, "Version: %d\n", secret.Version)
+	if updatedAt, ok := p.updatedAt(secret); ok {
+		fmt.Fprintf(&b, "Updated: %s\n", updatedAt.Local().Format(time.DateTime))
+	}
+	if len(secret.Tags) > 0 {
+		tags := make([]string, 0, len(secret.Tags))
+		for _, tag := range secret.Tags {
+			tags = append(tags, firstNonEmpty(tag.Name, tag.Slug))
+		}
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(tags, ", "))
+	}
+	if secret.SecretComment != "" {
+		fmt.Fprintf(&b, "Comment: %s\n", strings.ReplaceAll(secret.SecretComment, "\n", "\n  "))
+	}
+
+	summary, err := summarizeKubeconfig(secret.SecretValue)
+	if err != nil {
+		fmt.Fprintf(&b, "\nError parsing kubeconfig: %v\n", err)
+	} else {
+		for _, context := range summary.Contexts {
+			marker := ""
+			if context.Name == summary.CurrentContext {
+				marker = " (current)"
+			}
+			fmt.Fprintf(&b, "\nContext: %s%s\n", context.Name, marker)
+			fmt.Fprintf(&b, "  Cluster: %s\n", context.Cluster)
+			fmt.Fprintf(&b, "  Server: %s\n", context.Server)
+			if context.Namespace != "" {
+				fmt.Fprintf(&b, "  Namespace: %s\n", context.Namespace)
+			}
+			auth := context.AuthType
+			if context.ExecCommand != "" {
+				auth = fmt.Sprintf("%s (%s)", auth, context.ExecCommand)
+			}
+			fmt.Fprintf(&b, "  User: %s, %s\n", context.User, auth)
+			if !context.ClientCertExpiry.IsZero() {
+				fmt.Fprintf(&b, "  Client certificate expires: %s\n", formatExpiry(context.ClientCertExpiry, p.config.expiryWarning))
+			}
+			if !context.CAExpiry.IsZero() {
+				fmt.Fprintf(&b, "  CA certificate expires: %s\n", formatExpiry(context.CAExpiry, p.config.expiryWarning))
+			}
+			if !context.TokenExpiry.IsZero() {
+				fmt.Fprintf(&b, "  Token expires: %s\n", formatExpiry(context.TokenExpiry, p.config.expiryWarning))
+			}
+		}
+	}
+
+	if check, ok := p.checks[checkCacheKey(secret, p.config)]; ok {
+		fmt.Fprintf(&b, "\nLast check: %s\n  %s\n", check.CheckedAt.Local().Format(time.DateTime), check.summary())
+	}
+
+	if !p.cachedAt.IsZero() {
+		fmt.Fprintf(&b, "\nStale since: %s (offline cache)\n", p.cachedAt.Format(time.DateTime))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
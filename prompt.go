@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// promptSnippets prefix the prompt with the cluster of the ikube shell, e.g. "(⎈ eu/prod/cluster-a)".
+// They are meant to be evaluated from the shell startup file and leave the prompt untouched outside ikube shells.
+var promptSnippets = map[string]string{
+	"bash": `__ikube_prompt() {
+  [ -n "$IKUBE_CLUSTER" ] && printf '(⎈ %s) ' "$IKUBE_CLUSTER"
+}
+case "$PS1" in
+  *__ikube_prompt*) ;;
+  *) PS1='$(__ikube_prompt)'"$PS1" ;;
+esac
+`,
+	"zsh": `__ikube_prompt() {
+  [[ -n "$IKUBE_CLUSTER" ]] && printf '(⎈ %s) ' "$IKUBE_CLUSTER"
+}
+setopt PROMPT_SUBST
+if [[ "$PROMPT" != *__ikube_prompt* ]]; then
+  PROMPT='$(__ikube_prompt)'"$PROMPT"
+fi
+`,
+	"fish": `if not functions -q __ikube_original_fish_prompt
+  functions -c fish_prompt __ikube_original_fish_prompt
+  function fish_prompt
+    if set -q IKUBE_CLUSTER
+      printf '(⎈ %s) ' $IKUBE_CLUSTER
+    end
+    __ikube_original_fish_prompt
+  end
+end
+`,
+}
+
+// promptShells returns the shells supported by prompt-init, sorted by name
+func promptShells() []string {
+	shells := make([]string, 0, len(promptSnippets))
+	for shell := range promptSnippets {
+		shells = append(shells, shell)
+	}
+	slices.Sort(shells)
+	return shells
+}
+
+func handlePromptInit(shell string) {
+	snippet, ok := promptSnippets[shell]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported shell %s, use one of %s\n", shell, strings.Join(promptShells(), ", "))
+		exit(2)
+	}
+
+	fmt.Print(snippet)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+const tempKubeconfigPrefix = "kubeconfig-"
+
+var (
+	tempKubeconfigsMu sync.Mutex
+	tempKubeconfigs   = make(map[string]bool)
+
+	exitHooksMu  sync.Mutex
+	exitHooks    = make(map[int]func())
+	nextExitHook int
+
+	// runningChildren counts the shells and commands currently attached to the terminal,
+	// which handle the interrupt signal themselves
+	runningChildren atomic.Int32
+)
+
+// runtimeDir returns the private per-user directory holding temporary kubeconfigs, creating it if needed.
+// It lives in XDG_RUNTIME_DIR when available, which is usually a tmpfs cleared on logout.
+func runtimeDir() (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("ikube-%d", os.Getuid()))
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		dir = filepath.Join(runtime, "ikube")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create runtime directory: %v", err)
+	}
+
+	// Refuse a directory planted by someone else, e.g. a symlink in a shared /tmp
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to check runtime directory: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("runtime directory %s is not a directory", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", fmt.Errorf("failed to restrict runtime directory permissions: %v", err)
+		}
+	}
+
+	return dir, nil
+}
+
+// createOwnedKubeconfig writes content to a new file of the runtime directory whose name records ownerPID,
+// so that the file is swept once that process is gone
+func createOwnedKubeconfig(content []byte, ownerPID int) (string, error) {
+	dir, err := runtimeDir()
+	if err != nil {
+		return "", err
+	}
+
+	tmpfile, err := os.CreateTemp(dir, fmt.Sprintf("%s%d-*.yaml", tempKubeconfigPrefix, ownerPID))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+
+	defer tmpfile.Close()
+
+	// Write content directly to the open file descriptor to avoid TOCTOU
+	if _, err := tmpfile.Write(content); err != nil {
+		os.Remove(tmpfile.Name())
+		return "", fmt.Errorf("failed to write temporary file: %v", err)
+	}
+
+	return tmpfile.Name(), nil
+}
+
+func createTempKubeconfig(content []byte) (string, error) {
+	path, err := createOwnedKubeconfig(content, os.Getpid())
+	if err != nil {
+		return "", err
+	}
+
+	tempKubeconfigsMu.Lock()
+	tempKubeconfigs[path] = true
+	tempKubeconfigsMu.Unlock()
+
+	return path, nil
+}
+
+// removeTempKubeconfig deletes a temporary kubeconfig created by createTempKubeconfig
+func removeTempKubeconfig(path string) {
+	tempKubeconfigsMu.Lock()
+	delete(tempKubeconfigs, path)
+	tempKubeconfigsMu.Unlock()
+
+	os.Remove(path)
+}
+
+// cleanupTempKubeconfigs deletes every temporary kubeconfig that is still around
+func cleanupTempKubeconfigs() {
+	tempKubeconfigsMu.Lock()
+	defer tempKubeconfigsMu.Unlock()
+
+	for path := range tempKubeconfigs {
+		os.Remove(path)
+		delete(tempKubeconfigs, path)
+	}
+}
+
+// registerExitHook makes exit run fn, e.g. to restore the terminal, until the returned function is called
+func registerExitHook(fn func()) func() {
+	exitHooksMu.Lock()
+	defer exitHooksMu.Unlock()
+
+	id := nextExitHook
+	nextExitHook++
+	exitHooks[id] = fn
+	return func() {
+		exitHooksMu.Lock()
+		defer exitHooksMu.Unlock()
+		delete(exitHooks, id)
+	}
+}
+
+// exit runs the exit hooks and removes the temporary kubeconfigs before exiting, since os.Exit skips deferred calls
+func exit(code int) {
+	exitHooksMu.Lock()
+	for _, fn := range exitHooks {
+		fn()
+	}
+	exitHooksMu.Unlock()
+
+	cleanupTempKubeconfigs()
+	os.Exit(code)
+}
+
+// trackChild marks a shell or command as attached to the terminal until the returned function is called
+func trackChild() func() {
+	runningChildren.Add(1)
+	return func() {
+		runningChildren.Add(-1)
+	}
+}
+
+// handleSignals removes the temporary kubeconfigs and exits when ikube is interrupted or terminated.
+// While a child is running, the signals are left to it: ikube cleans up once the child exits.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		for sig := range signals {
+			if runningChildren.Load() > 0 {
+				continue
+			}
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			exit(code)
+		}
+	}()
+}
+
+// processAlive reports whether a process with the given PID is still running
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// sweepStaleKubeconfigs removes the temporary kubeconfigs left behind by ikube processes
+// that are gone, e.g. after a crash or a SIGKILL
+func sweepStaleKubeconfigs() {
+	dir, err := runtimeDir()
+	if err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, tempKubeconfigPrefix) {
+			continue
+		}
+		pidPart, _, found := strings.Cut(strings.TrimPrefix(name, tempKubeconfigPrefix), "-")
+		if !found {
+			continue
+		}
+		pid, err := strconv.Atoi(pidPart)
+		if err != nil || processAlive(pid) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, name))
+	}
+}
@@ -4,8 +4,42 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	// clusterEnvVar holds the cluster loaded in an ikube shell, for prompts and scripts
+	clusterEnvVar = "IKUBE_CLUSTER"
+	// sessionEnvVar identifies the process owning the temporary kubeconfig of a shell: the ikube process
+	// that spawned it, or the shell itself in hook mode
+	sessionEnvVar = "IKUBE_SESSION"
 )
 
+// confirmNestedShell warns when ikube is already running inside an ikube shell and, when
+// interactive, asks before stacking another shell on top of it
+func confirmNestedShell() bool {
+	current := os.Getenv(clusterEnvVar)
+	session := os.Getenv(sessionEnvVar)
+
+	// In hook mode the session is the calling shell itself, nothing would be nested
+	if current == "" || session == strconv.Itoa(os.Getppid()) {
+		return true
+	}
+
+	fmt.Printf("Warning: Already in an ikube shell for cluster %s, a new shell will be nested in it\n", current)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return true
+	}
+
+	fmt.Print("Start a nested shell anyway? [y/N]: ")
+	var confirmation string
+	fmt.Scanln(&confirmation)
+	return strings.ToLower(confirmation) == "y"
+}
+
 func launchShellWithKubeconfig(kubeconfigPath string, clusterName string, config appConfig) error {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
@@ -20,6 +54,8 @@ func launchShellWithKubeconfig(kubeconfigPath string, clusterName string, config
 	// Set up environment
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath))
+	env = append(env, fmt.Sprintf("%s=%s", clusterEnvVar, clusterName))
+	env = append(env, fmt.Sprintf("%s=%s", sessionEnvVar, strconv.Itoa(os.Getpid())))
 	cmd.Env = env
 
 	// Print information about the temporary session
@@ -28,8 +64,18 @@ func launchShellWithKubeconfig(kubeconfigPath string, clusterName string, config
 	fmt.Println("Exit the shell to clean up the temporary kubeconfig")
 	fmt.Println()
 
-	// Run the shell
-	err := cmd.Run()
+	// Run the shell, leaving the signals to it while it is attached to the terminal
+	defer trackChild()()
+	if err := cmd.Start(); err != nil {
+		if config.verbose {
+			return fmt.Errorf("error starting shell: %v", err)
+		}
+		return fmt.Errorf("error starting shell")
+	}
+	stop := forwardSignals(cmd)
+	defer stop()
+
+	err := cmd.Wait()
 	if err != nil {
 		if config.verbose {
 			return fmt.Errorf("error running shell: %v", err)
@@ -39,21 +85,3 @@ func launchShellWithKubeconfig(kubeconfigPath string, clusterName string, config
 
 	return nil
 }
-
-func createTempKubeconfig(content []byte) (string, error) {
-	// Create temporary file
-	tmpfile, err := os.CreateTemp("", "kubeconfig-*.yaml")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %v", err)
-	}
-
-	defer tmpfile.Close()
-
-	// Write content directly to the open file descriptor to avoid TOCTOU
-	if _, err := tmpfile.Write(content); err != nil {
-		os.Remove(tmpfile.Name())
-		return "", fmt.Errorf("failed to write temporary file: %v", err)
-	}
-
-	return tmpfile.Name(), nil
-}
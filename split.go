@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var invalidSecretKeyChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// contextSecretKey turns a context name into a secret key, e.g. "arn:aws:eks:eu-west-1:123:cluster/prod"
+// becomes "arn-aws-eks-eu-west-1-123-cluster-prod"
+func contextSecretKey(contextName string) string {
+	return strings.Trim(invalidSecretKeyChars.ReplaceAllString(contextName, "-"), "-")
+}
+
+// extractContext returns a kubeconfig holding only the given context with its cluster and user
+func extractContext(kubeCfg *api.Config, contextName string) (*api.Config, error) {
+	extracted := kubeCfg.DeepCopy()
+	extracted.CurrentContext = contextName
+	if err := api.MinifyConfig(extracted); err != nil {
+		return nil, err
+	}
+	return extracted, nil
+}
+
+// selectContexts returns the contexts to import, from the --context or --all flags,
+// or else from an interactive multi-selection
+func selectContexts(kubeCfg *api.Config, config appConfig) []string {
+	names := make([]string, 0, len(kubeCfg.Contexts))
+	for name := range kubeCfg.Contexts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if config.allContexts {
+		return names
+	}
+
+	if config.contexts != "" {
+		var selected []string
+		for _, name := range strings.Split(config.contexts, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || slices.Contains(selected, name) {
+				continue
+			}
+			selected = append(selected, name)
+			if _, exists := kubeCfg.Contexts[name]; !exists {
+				fmt.Printf("Error: Context '%s' not found in kubeconfig\n", name)
+				exit(1)
+			}
+		}
+		return selected
+	}
+
+	if len(names) == 1 {
+		return names
+	}
+
+	// Use fuzzy finder to select the contexts to import
+	indices, err := fuzzyfinder.FindMulti(
+		names,
+		func(i int) string {
+			return names[i]
+		},
+		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
+			if i == -1 {
+				return ""
+			}
+			context := kubeCfg.Contexts[names[i]]
+			server := ""
+			if cluster, exists := kubeCfg.Clusters[context.Cluster]; exists {
+				server = cluster.Server
+			}
+			return fmt.Sprintf("Context: %s\nCluster: %s\nServer: %s\nUser: %s\nNamespace: %s\nSecret: %s",
+				names[i],
+				context.Cluster,
+				server,
+				context.AuthInfo,
+				context.Namespace,
+				contextSecretKey(names[i]))
+		}),
+	)
+
+	if err != nil {
+		if err == fuzzyfinder.ErrAbort {
+			fmt.Println("Selection cancelled")
+			exit(0)
+		}
+		if config.verbose {
+			fmt.Printf("Error during selection: %v\n", err)
+		} else {
+			fmt.Println("Error during selection")
+		}
+		exit(1)
+	}
+
+	selected := make([]string, 0, len(indices))
+	for _, idx := range indices {
+		selected = append(selected, names[idx])
+	}
+	return selected
+}
+
+// splitKubeconfig turns each selected context of kubeCfg into its own kubeconfig entry, exiting on invalid contexts
+func splitKubeconfig(kubeCfg *api.Config, config appConfig) []kubeconfigEntry {
+	contexts := selectContexts(kubeCfg, config)
+	if len(contexts) == 0 {
+		fmt.Println("No contexts selected for import")
+		exit(0)
+	}
+
+	// Distinct context names can map to the same key, e.g. "a/b" and "a:b", which would overwrite each other
+	keys := make(map[string]string, len(contexts))
+	for _, contextName := range contexts {
+		key := contextSecretKey(contextName)
+		if key == "" {
+			fmt.Printf("Error: Context '%s' cannot be turned into a secret key\n", contextName)
+			exit(1)
+		}
+		if other, exists := keys[key]; exists {
+			fmt.Printf("Error: Contexts '%s' and '%s' would both be stored as '%s', rename one of them\n", other, contextName, key)
+			exit(1)
+		}
+		keys[key] = contextName
+	}
+
+	entries := make([]kubeconfigEntry, 0, len(contexts))
+	for _, contextName := range contexts {
+		// Credentials referenced as files only count once embedded, so flatten before validating
+		extracted, err := extractContext(kubeCfg, contextName)
+		if err == nil {
+			flattenStoredKubeconfig(extracted, config)
+			err = validateKubeconfig(extracted)
+		}
+		if err != nil {
+			if config.verbose {
+				fmt.Printf("Error: Invalid context '%s': %v\n", contextName, err)
+			} else {
+				fmt.Printf("Error: Invalid context '%s'\n", contextName)
+			}
+			exit(1)
+		}
+
+		data, err := clientcmd.Write(*extracted)
+		if err != nil {
+			if config.verbose {
+				fmt.Printf("Error serializing context '%s': %v\n", contextName, err)
+			} else {
+				fmt.Printf("Error serializing context '%s'\n", contextName)
+			}
+			exit(1)
+		}
+
+		entries = append(entries, kubeconfigEntry{
+			key:    contextSecretKey(contextName),
+			value:  string(data),
+			server: extracted.Clusters[extracted.Contexts[contextName].Cluster].Server,
+		})
+	}
+
+	return entries
+}